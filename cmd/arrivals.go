@@ -1,285 +1,1967 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"os"
+	"os/signal"
 	"sort"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
 	"github.com/spf13/cobra"
-	"google.golang.org/protobuf/proto"
 )
 
 // Arrival represents a single arrival event
 type Arrival struct {
 	StopID  string
 	RouteID string
-	Arrival time.Time
+	TripID  string
+	// StartDate and StartTime are the trip's scheduled start,
+	// as YYYYMMDD and HH:MM:SS
+	StartDate string
+	StartTime string
+	Arrival   time.Time
+	// FromDeparture is set when the feed had no arrival time for the stop
+	// and the departure time was used instead, as happens at terminals
+	FromDeparture bool
+	// Scheduled is set for arrivals from the static schedule rather than
+	// the realtime feed
+	Scheduled bool
+	// Destination is the stop ID of the last stop the trip is predicted
+	// to reach, or empty if unknown
+	Destination string
+	// Delay is the delay reported by the feed, zero if it reports none
+	Delay time.Duration
+	// TrainID, ScheduledTrack and ActualTrack come from the NYCT feed
+	// extensions and are empty when the feed doesn't provide them
+	TrainID        string
+	ScheduledTrack string
+	ActualTrack    string
+	// Updated is when the feed last updated the trip's prediction, or zero
+	// if the feed doesn't say
+	Updated time.Time
+	// StopsAway is how many stops the train makes before this one
+	StopsAway int
+	// ScheduledAt is the time the static schedule gives for the trip at
+	// the stop, set by --vs-schedule, or zero if the trip wasn't matched
+	ScheduledAt time.Time
 }
 
-// fetchFeed fetches and parses the MTA GTFS-Realtime feed
-// Filters for routes 1, 2, and 3
-func fetchFeed() ([]Arrival, error) {
-	// MTA endpoint for A Division (1, 2, 3, 4, 5, 6, S)
-	url := "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs"
+// readQueries reads newline-separated station queries, skipping blank lines
+func readQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if query := strings.TrimSpace(scanner.Text()); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queries: %w", err)
+	}
+	return queries, nil
+}
 
-	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// logFeedStats writes the fetch timings of each feed to stderr
+func logFeedStats(stats []FeedStats) {
+	for _, feed := range stats {
+		if feed.NotModified {
+			fmt.Fprintf(os.Stderr, "%s: not modified, reused %d entities (%s)\n",
+				feed.Feed, feed.Entities, feed.RoundTrip.Round(time.Millisecond))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: fetched %d entities in %s (round trip %s, parse %s)\n",
+			feed.Feed, feed.Entities, feed.Total().Round(time.Millisecond),
+			feed.RoundTrip.Round(time.Millisecond), feed.Parse.Round(time.Millisecond))
 	}
+}
 
-	// Execute request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+// maxRateLimitBackoff caps the pause after repeated rate limits without Retry-After
+const maxRateLimitBackoff = 10 * time.Minute
+
+// rateLimitBackoff returns how long watch mode pauses after the n-th rate
+// limited fetch in a row: the Retry-After delay if the endpoint gave one,
+// otherwise the refresh interval doubled for each consecutive rate limit
+func rateLimitBackoff(err *RateLimitError, interval time.Duration, n int) time.Duration {
+	if err.RetryAfter > 0 {
+		return err.RetryAfter
 	}
-	defer resp.Body.Close()
+	wait := interval
+	for i := 0; i < n && wait < maxRateLimitBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRateLimitBackoff)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// alignDelay returns how long until the next multiple of interval on the
+// wall clock, e.g. the next :00 or :30 second for 30s. Watch modes started
+// at different times then refresh in sync.
+func alignDelay(now time.Time, interval time.Duration) time.Duration {
+	return now.Truncate(interval).Add(interval).Sub(now)
+}
+
+// formatHealth describes the watch mode connection from the number of
+// consecutive failed fetches, e.g. "● connected" or "○ 2 failed fetches, retrying"
+func formatHealth(failures int) string {
+	switch {
+	case failures == 0:
+		return colorize("● connected", "32")
+	case failures == 1:
+		return colorize("○ 1 failed fetch, retrying", "31")
+	default:
+		return colorize(fmt.Sprintf("○ %d failed fetches, retrying", failures), "31")
 	}
+}
 
-	// Read the response body
-	data, err := io.ReadAll(resp.Body)
+// currentTime returns the reference instant for relative times: the
+// --now override when set, otherwise the wall clock
+func currentTime() time.Time {
+	if !asOf.IsZero() {
+		return asOf
+	}
+	return time.Now()
+}
+
+// parseAsOf parses the --now flag value as an RFC 3339 timestamp
+func parseAsOf(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return time.Time{}, fmt.Errorf("invalid --now %q, expected RFC 3339 such as 2024-05-01T08:30:00-04:00", value)
 	}
+	return t, nil
+}
 
-	// Parse protobuf
-	feed := &gtfs.FeedMessage{}
-	if err := proto.Unmarshal(data, feed); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+// checkFeedAge returns an error if the feed timestamp is older than maxAge
+// at now, or if the feed did not report a timestamp
+func checkFeedAge(feedTime, now time.Time, maxAge time.Duration) error {
+	if feedTime.IsZero() {
+		return errors.New("feed did not report a timestamp")
 	}
+	if age := now.Sub(feedTime); age > maxAge {
+		return fmt.Errorf("feed data is stale: generated %s ago (threshold %s)", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
 
-	// Extract arrivals for routes 1, 2, 3
-	var arrivals []Arrival
-	now := time.Now()
+// expandStopIDs converts stop IDs to a set, expanding parent stop IDs to
+// their directional children. Returns nil for no IDs.
+func expandStopIDs(ids []string, index StopIndex) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, id := range ids {
+		set[id] = true
+		for _, child := range index.Children[id] {
+			set[child] = true
+		}
+	}
+	return set
+}
 
-	for _, entity := range feed.GetEntity() {
-		tripUpdate := entity.GetTripUpdate()
-		if tripUpdate == nil {
+// filterStops keeps only the arrivals at the given stops (all stops if nil),
+// then drops the arrivals at the excluded stops
+func filterStops(arrivals []Arrival, only, exclude map[string]bool) []Arrival {
+	var filtered []Arrival
+	for _, arrival := range arrivals {
+		if only != nil && !only[arrival.StopID] {
 			continue
 		}
+		if exclude[arrival.StopID] {
+			continue
+		}
+		filtered = append(filtered, arrival)
+	}
+	return filtered
+}
 
-		trip := tripUpdate.GetTrip()
-		if trip == nil {
+// warnUnseenStops warns on stderr about stop IDs that are neither in the
+// static stop data nor in the feed, which are most likely typos
+func warnUnseenStops(ids []string, arrivals []Arrival, index StopIndex) {
+	for _, id := range ids {
+		if _, ok := index.StopIDToName[id]; ok {
+			continue
+		}
+		if containsStop(arrivals, id) {
 			continue
 		}
+		fmt.Fprintf(os.Stderr, "Warning: stop %s does not appear in the stop data or the feed\n", id)
+	}
+}
 
-		routeID := trip.GetRouteId()
-		// Filter for routes 1, 2, 3
-		if routeID != "1" && routeID != "2" && routeID != "3" {
+// filterMinMinutes drops arrivals sooner than the given number of minutes after now
+func filterMinMinutes(arrivals []Arrival, now time.Time, minutes int) []Arrival {
+	cutoff := now.Add(time.Duration(minutes) * time.Minute)
+
+	var filtered []Arrival
+	for _, arrival := range arrivals {
+		if arrival.Arrival.Before(cutoff) {
 			continue
 		}
+		filtered = append(filtered, arrival)
+	}
+	return filtered
+}
 
-		// Process stop time updates
-		for _, stopTimeUpdate := range tripUpdate.GetStopTimeUpdate() {
-			arrivalEvent := stopTimeUpdate.GetArrival()
-			if arrivalEvent == nil {
-				continue
-			}
+// dedupeArrivals merges near-identical predictions: arrivals for the same
+// stop and route whose times fall within window of the first one in a run
+// are treated as one, keeping the earliest or (if keepLater) the latest
+func dedupeArrivals(arrivals []Arrival, window time.Duration, keepLater bool) []Arrival {
+	if window <= 0 || len(arrivals) < 2 {
+		return arrivals
+	}
 
-			arrivalTime := arrivalEvent.GetTime()
-			if arrivalTime == 0 {
-				continue
-			}
+	sorted := append([]Arrival{}, arrivals...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].StopID != sorted[j].StopID {
+			return sorted[i].StopID < sorted[j].StopID
+		}
+		if sorted[i].RouteID != sorted[j].RouteID {
+			return sorted[i].RouteID < sorted[j].RouteID
+		}
+		return sorted[i].Arrival.Before(sorted[j].Arrival)
+	})
 
-			// Convert Unix timestamp to time.Time
-			t := time.Unix(arrivalTime, 0)
+	var deduped []Arrival
+	start := 0 // index of the first arrival in the current run
+	for i := 1; i <= len(sorted); i++ {
+		if i < len(sorted) &&
+			sorted[i].StopID == sorted[start].StopID &&
+			sorted[i].RouteID == sorted[start].RouteID &&
+			sorted[i].Arrival.Sub(sorted[start].Arrival) <= window {
+			continue
+		}
+		if keepLater {
+			deduped = append(deduped, sorted[i-1])
+		} else {
+			deduped = append(deduped, sorted[start])
+		}
+		start = i
+	}
 
-			// Filter out past arrivals
-			if t.Before(now) {
-				continue
-			}
+	return deduped
+}
+
+// resolveStops resolves a station query like ResolveStation, except that a
+// name shared by distinct stations is accepted when routes are given, since
+// the route filter then tells the stations apart
+func resolveStops(station string, routes []string, index StopIndex) ([]string, error) {
+	stopIDs, err := ResolveStation(station, index)
+	var dup *DuplicateStationError
+	if errors.As(err, &dup) && len(routes) > 0 {
+		return dup.StopIDs, nil
+	}
+	return stopIDs, err
+}
 
-			stopID := stopTimeUpdate.GetStopId()
-			if stopID == "" {
+// annotateCandidates fills in the routes seen at each candidate station
+func annotateCandidates(dup *DuplicateStationError, arrivals []Arrival, stops map[string]Stop) {
+	for i, candidate := range dup.Candidates {
+		seen := make(map[string]bool)
+		for _, arrival := range arrivals {
+			stop := stops[arrival.StopID]
+			if arrival.StopID != candidate.StopID && stop.ParentStation != candidate.StopID {
 				continue
 			}
-
-			arrivals = append(arrivals, Arrival{
-				StopID:  stopID,
-				RouteID: routeID,
-				Arrival: t,
-			})
+			if !seen[arrival.RouteID] {
+				seen[arrival.RouteID] = true
+				dup.Candidates[i].Routes = append(dup.Candidates[i].Routes, arrival.RouteID)
+			}
 		}
+		sort.Strings(dup.Candidates[i].Routes)
 	}
-
-	return arrivals, nil
 }
 
-// filterArrivals filters the list of arrivals by station name or stop ID
-func filterArrivals(arrivals []Arrival, station string, nameToIDs map[string][]string) []Arrival {
+// filterArrivals filters the list of arrivals by station name or stop ID,
+// and by route. An empty station or route list matches everything. With
+// bothDirections, a directional stop also matches the opposite platform.
+// The station is resolved with ResolveStation, whose errors are returned.
+func filterArrivals(arrivals []Arrival, station string, routes []string, index StopIndex, bothDirections bool) ([]Arrival, error) {
 	var filtered []Arrival
-	
-	// Check if station looks like a stop ID (alphanumeric, possibly with N/S suffix)
-	// If it matches a stop ID directly, use it
-	// Otherwise, treat it as a station name and lookup associated stop IDs
-	
+
+	// The route filter always applies, so a shared platform can be
+	// narrowed to a single line
+	var wantedRoutes map[string]bool
+	if len(routes) > 0 {
+		wantedRoutes = routeSet(routes)
+	}
+
 	var targetStopIDs map[string]bool
-	
-	// First, check if it's a direct stop ID match
-	isDirectMatch := false
-	for _, arrival := range arrivals {
-		if arrival.StopID == station {
-			isDirectMatch = true
-			break
-		}
-	}
-	
-	if isDirectMatch {
-		// Direct stop ID match
-		targetStopIDs = map[string]bool{station: true}
-	} else {
-		// Try to find by station name
-		stopIDs := nameToIDs[station]
-		if len(stopIDs) == 0 {
-			// No match found
-			return filtered
+	if station != "" {
+		// A stop ID present in the feed is used directly, even if the static
+		// data doesn't know it; otherwise resolve the station query
+		stopIDs := []string{station}
+		if !containsStop(arrivals, station) {
+			var err error
+			stopIDs, err = resolveStops(station, routes, index)
+			if err != nil {
+				// List the routes seen at each station sharing the name
+				var dup *DuplicateStationError
+				if errors.As(err, &dup) {
+					annotateCandidates(dup, arrivals, index.Stops)
+				}
+				return nil, err
+			}
 		}
 		targetStopIDs = make(map[string]bool)
 		for _, id := range stopIDs {
 			targetStopIDs[id] = true
+			if bothDirections {
+				if opposite := oppositeStop(id); opposite != "" {
+					targetStopIDs[opposite] = true
+				}
+			}
 		}
 	}
-	
+
 	// Filter arrivals
 	for _, arrival := range arrivals {
-		if targetStopIDs[arrival.StopID] {
+		if targetStopIDs != nil && !targetStopIDs[arrival.StopID] {
+			continue
+		}
+		if wantedRoutes != nil && !wantedRoutes[normalizeRoute(arrival.RouteID)] {
+			continue
+		}
+		filtered = append(filtered, arrival)
+	}
+
+	return filtered, nil
+}
+
+// filterTrip keeps the arrivals of a single trip, matched by trip ID or
+// by NYCT train ID
+func filterTrip(arrivals []Arrival, trip string) []Arrival {
+	trip = strings.TrimSpace(trip)
+	var filtered []Arrival
+	for _, arrival := range arrivals {
+		if arrival.TripID == trip || (arrival.TrainID != "" && arrival.TrainID == trip) {
+			filtered = append(filtered, arrival)
+		}
+	}
+	return filtered
+}
+
+// firstPerTrip keeps the soonest arrival of each trip, so that every train
+// appears once, at the next stop it makes among the arrivals. Arrivals
+// without a trip ID are all kept.
+func firstPerTrip(arrivals []Arrival) []Arrival {
+	sortArrivals(arrivals)
+	seen := make(map[string]bool)
+	var trains []Arrival
+	for _, arrival := range arrivals {
+		if arrival.TripID != "" {
+			key := arrival.RouteID + "/" + arrival.TripID
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		trains = append(trains, arrival)
+	}
+	return trains
+}
+
+// filterTerminatingAt keeps the arrivals of trips whose last predicted stop
+// is one of stopIDs or a platform of one of them. Arrivals without a known
+// destination, such as scheduled ones, are dropped.
+func filterTerminatingAt(arrivals []Arrival, stopIDs []string, stops map[string]Stop) []Arrival {
+	terminals := make(map[string]bool, len(stopIDs))
+	for _, id := range stopIDs {
+		terminals[id] = true
+	}
+	var filtered []Arrival
+	for _, arrival := range arrivals {
+		destination := arrival.Destination
+		if destination == "" {
+			continue
+		}
+		parent := stops[destination].ParentStation
+		if parent == "" {
+			parent = strings.TrimSuffix(destination, stopDirection(destination))
+		}
+		if terminals[destination] || terminals[parent] {
 			filtered = append(filtered, arrival)
 		}
 	}
-	
 	return filtered
 }
 
-// displayArrivals displays the arrivals in a formatted table
-func displayArrivals(arrivals []Arrival, stopIDToName map[string]string) {
-	// Sort by arrival time
+// printTripHeading writes a line describing the trip being followed:
+// its route, destination, and the number of stops left
+func printTripHeading(w io.Writer, arrivals []Arrival, stopIDToName map[string]string) {
+	first := arrivals[0]
+	heading := fmt.Sprintf("Trip %s: %s train", first.TripID, first.RouteID)
+	if first.Destination != "" {
+		destination, _ := lookupStationName(first.Destination, stopIDToName)
+		heading += " to " + destination
+	}
+	fmt.Fprintf(w, "%s, %d stops remaining\n\n", heading, len(arrivals))
+}
+
+// containsStop reports whether any arrival is at the given stop ID
+func containsStop(arrivals []Arrival, stopID string) bool {
+	for _, arrival := range arrivals {
+		if arrival.StopID == stopID {
+			return true
+		}
+	}
+	return false
+}
+
+// sortArrivals sorts the arrivals by arrival time. Arrivals at the same
+// time are ordered by route, direction, trip ID, and stop ID, so the output
+// is the same from one run to the next.
+func sortArrivals(arrivals []Arrival) {
 	sort.Slice(arrivals, func(i, j int) bool {
-		return arrivals[i].Arrival.Before(arrivals[j].Arrival)
+		a, b := arrivals[i], arrivals[j]
+		if !a.Arrival.Equal(b.Arrival) {
+			return a.Arrival.Before(b.Arrival)
+		}
+		if a.RouteID != b.RouteID {
+			return a.RouteID < b.RouteID
+		}
+		if da, db := stopDirection(a.StopID), stopDirection(b.StopID); da != db {
+			return da < db
+		}
+		if a.TripID != b.TripID {
+			return a.TripID < b.TripID
+		}
+		return a.StopID < b.StopID
 	})
+}
 
-	// Display arrivals with station names
-	fmt.Printf("%-10s %-8s %-35s %s\n", "STOP_ID", "ROUTE", "STATION", "ARRIVAL_TIME")
-	fmt.Println("--------------------------------------------------------------------------------")
+// stopDirection returns the direction suffix (N or S) of a stop ID,
+// or an empty string if the stop ID has no direction
+func stopDirection(stopID string) string {
+	if strings.HasSuffix(stopID, "N") {
+		return "N"
+	}
+	if strings.HasSuffix(stopID, "S") {
+		return "S"
+	}
+	return ""
+}
+
+// oppositeStop returns the stop ID for the other direction of a directional
+// stop ID, e.g. 116S for 116N, or an empty string if it has no direction
+func oppositeStop(stopID string) string {
+	switch stopDirection(stopID) {
+	case "N":
+		return strings.TrimSuffix(stopID, "N") + "S"
+	case "S":
+		return strings.TrimSuffix(stopID, "S") + "N"
+	}
+	return ""
+}
+
+// ArrivalGroup represents the arrivals for a single route and direction
+type ArrivalGroup struct {
+	RouteID   string
+	Direction string
+	Arrivals  []Arrival
+}
+
+// groupByRouteDirection groups the arrivals by route and direction,
+// keeping only the soonest n arrivals of each group
+func groupByRouteDirection(arrivals []Arrival, n int) []ArrivalGroup {
+	sortArrivals(arrivals)
+
+	var groups []ArrivalGroup
+	index := make(map[string]int)
 	for _, arrival := range arrivals {
-		stationName := stopIDToName[arrival.StopID]
-		if stationName == "" {
-			stationName = "(unknown)"
-		}
-		fmt.Printf("%-10s %-8s %-35s %s\n",
-			arrival.StopID,
-			arrival.RouteID,
-			stationName,
-			arrival.Arrival.Format("3:04 PM"),
-		)
+		key := arrival.RouteID + "/" + stopDirection(arrival.StopID)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ArrivalGroup{
+				RouteID:   arrival.RouteID,
+				Direction: stopDirection(arrival.StopID),
+			})
+		}
+		if len(groups[i].Arrivals) < n {
+			groups[i].Arrivals = append(groups[i].Arrivals, arrival)
+		}
+	}
+
+	// Order groups by route, then direction
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].RouteID != groups[j].RouteID {
+			return groups[i].RouteID < groups[j].RouteID
+		}
+		return groups[i].Direction < groups[j].Direction
+	})
+
+	return groups
+}
+
+// StationGroup represents the arrivals at a single station
+type StationGroup struct {
+	Station  string
+	Arrivals []Arrival
+}
+
+// groupByStation groups the arrivals by station name, ordered by name
+func groupByStation(arrivals []Arrival, stopIDToName map[string]string) []StationGroup {
+	var groups []StationGroup
+	index := make(map[string]int)
+	for _, arrival := range arrivals {
+		stationName, _ := lookupStationName(arrival.StopID, stopIDToName)
+		i, ok := index[stationName]
+		if !ok {
+			i = len(groups)
+			index[stationName] = i
+			groups = append(groups, StationGroup{Station: stationName})
+		}
+		groups[i].Arrivals = append(groups[i].Arrivals, arrival)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Station < groups[j].Station
+	})
+
+	return groups
+}
+
+// sortStationGroupsByNext orders station groups by their earliest upcoming
+// arrival, so the station with the next train comes first
+func sortStationGroupsByNext(groups []StationGroup) {
+	next := func(group StationGroup) time.Time {
+		var earliest time.Time
+		for _, arrival := range group.Arrivals {
+			if earliest.IsZero() || arrival.Arrival.Before(earliest) {
+				earliest = arrival.Arrival
+			}
+		}
+		return earliest
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return next(groups[i]).Before(next(groups[j]))
+	})
+}
+
+// stationGroups groups the arrivals by station, ordered by --group-sort
+func stationGroups(arrivals []Arrival, stopIDToName map[string]string) []StationGroup {
+	groups := groupByStation(arrivals, stopIDToName)
+	if groupSort == "next" {
+		sortStationGroupsByNext(groups)
 	}
-	fmt.Printf("\nTotal: %d upcoming arrivals\n", len(arrivals))
+	return groups
 }
 
+// tableRuleWidth is the width of the rule under the arrivals table header
+const tableRuleWidth = 80
 
-var watchMode bool
+// printArrivalHeader writes the column header of the arrivals table to w
+func printArrivalHeader(w io.Writer) {
+	writeTableRow(w, tableColumns, func(col column) (string, string) {
+		return col.Header, col.Header
+	})
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, strings.Repeat("-", tableRuleWidth))
+}
+
+// lookupStationName returns the station name for a stop ID. If the stop ID
+// is missing from the map, it retries without the directional suffix as a
+// best effort. The boolean reports whether the stop ID itself was known.
+func lookupStationName(stopID string, stopIDToName map[string]string) (string, bool) {
+	if name := stopIDToName[stopID]; name != "" {
+		return name, true
+	}
+	if direction := stopDirection(stopID); direction != "" {
+		if name := stopIDToName[strings.TrimSuffix(stopID, direction)]; name != "" {
+			return name, false
+		}
+	}
+	return "(unknown)", false
+}
+
+// unknownStopIDs returns the sorted set of stop IDs in arrivals that are
+// missing from the stop map
+func unknownStopIDs(arrivals []Arrival, stopIDToName map[string]string) []string {
+	seen := make(map[string]bool)
+	var unknown []string
+	for _, arrival := range arrivals {
+		if _, known := lookupStationName(arrival.StopID, stopIDToName); known || seen[arrival.StopID] {
+			continue
+		}
+		seen[arrival.StopID] = true
+		unknown = append(unknown, arrival.StopID)
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// printUnknownStopsNote writes a note about stop IDs missing from the static data
+func printUnknownStopsNote(w io.Writer, unknown []string) {
+	if len(unknown) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nNote: %d stop ID(s) not found in %s: %s\n", len(unknown), stopsFile, strings.Join(unknown, ", "))
+	fmt.Fprintf(w, "The static GTFS data may be out of date; consider updating %s.\n", stopsFile)
+}
+
+// formatArrivalTime formats the arrival time, labelling departure-based times
+func formatArrivalTime(arrival Arrival) string {
+	formatted := formatClock(arrival.Arrival)
+	// With --mode from every time is a departure, so none is labelled
+	if arrival.FromDeparture && eventMode != "from" {
+		formatted += " (dep)"
+	}
+	// Label the source when realtime and scheduled arrivals are mixed
+	if withSchedule {
+		if arrival.Scheduled {
+			formatted += " sched"
+		} else {
+			formatted += " rt"
+		}
+	}
+	return formatted
+}
+
+// stopLinks maps stop IDs to the URLs their station names link to.
+// It is nil unless --links is enabled on a terminal.
+var stopLinks map[string]string
+
+// mapLinks builds OpenStreetMap URLs for every stop with coordinates
+func mapLinks(stops map[string]Stop) map[string]string {
+	links := make(map[string]string, len(stops))
+	for id, stop := range stops {
+		if stop.Lat == 0 && stop.Lon == 0 {
+			continue
+		}
+		links[id] = fmt.Sprintf("https://www.openstreetmap.org/?mlat=%f&mlon=%f#map=17/%f/%f",
+			stop.Lat, stop.Lon, stop.Lat, stop.Lon)
+	}
+	return links
+}
+
+// formatMinutesAway formats how far in the future t is, in whole minutes,
+// or in seconds when it is closer than --seconds-threshold, e.g. "45s" or "1m 05s"
+func formatMinutesAway(t, now time.Time) string {
+	away := t.Sub(now)
+	if away < secondsBelow {
+		seconds := int(away.Seconds())
+		switch {
+		case seconds < 1:
+			return "now"
+		case seconds < 60:
+			return fmt.Sprintf("%ds", seconds)
+		}
+		return fmt.Sprintf("%dm %02ds", seconds/60, seconds%60)
+	}
+	minutes := int(away.Minutes())
+	if minutes < 1 {
+		return "now"
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+// formatTrip formats the trip ID with the trip's scheduled start, for debugging
+func formatTrip(arrival Arrival) string {
+	if arrival.TripID == "" {
+		return "-"
+	}
+	start := strings.TrimSpace(arrival.StartDate + " " + arrival.StartTime)
+	if start == "" {
+		return arrival.TripID
+	}
+	return fmt.Sprintf("%s (start %s)", arrival.TripID, start)
+}
+
+// formatStopsAway formats how many stops away the train is, e.g. "next"
+// or "3 stops"
+func formatStopsAway(arrival Arrival) string {
+	switch {
+	case arrival.Scheduled:
+		return "-"
+	case arrival.StopsAway == 0:
+		return "next"
+	case arrival.StopsAway == 1:
+		return "1 stop"
+	default:
+		return fmt.Sprintf("%d stops", arrival.StopsAway)
+	}
+}
+
+// formatTrack formats the track a train uses at a stop: the actual track,
+// marked with * when it differs from the scheduled one, or "-" if unknown
+func formatTrack(arrival Arrival) string {
+	switch {
+	case arrival.ActualTrack == "":
+		if arrival.ScheduledTrack == "" {
+			return "-"
+		}
+		return arrival.ScheduledTrack
+	case arrival.ScheduledTrack != "" && arrival.ActualTrack != arrival.ScheduledTrack:
+		return arrival.ActualTrack + "*"
+	default:
+		return arrival.ActualTrack
+	}
+}
+
+// markStale flags stale predictions when styling is disabled
+const markStale = "(stale)"
+
+// isStale reports whether the prediction for an arrival was last updated
+// more than maxAge before now. Predictions without an update time, and
+// every prediction when maxAge is zero, are not stale.
+func isStale(arrival Arrival, now time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && !arrival.Updated.IsZero() && now.Sub(arrival.Updated) > maxAge
+}
+
+// printArrivalRow writes a single row of the arrivals table to w,
+// followed by an optional change marker. Stale predictions are dimmed and
+// preferred routes are bold, or marked when styling is disabled.
+func printArrivalRow(w io.Writer, arrival Arrival, stopIDToName map[string]string, mark string) {
+	now := currentTime()
+	stale := isStale(arrival, now, staleAfter)
+	preferred := preferredRoutes[normalizeRoute(arrival.RouteID)]
+	writeTableRow(w, tableColumns, func(col column) (string, string) {
+		text := col.Value(arrival, stopIDToName, now)
+		decorated := text
+		if col.Decorate != nil {
+			decorated = col.Decorate(arrival, text)
+		}
+		if stale && colorOutput {
+			decorated = withStyle(decorated, "2", "22") // ANSI dim
+		}
+		if preferred && colorOutput {
+			decorated = withStyle(decorated, "1", "22") // ANSI bold
+		}
+		return text, decorated
+	})
+	if preferred && !colorOutput {
+		mark = strings.TrimSpace(markPreferred + " " + mark)
+	}
+	if stale && !colorOutput {
+		mark = strings.TrimSpace(mark + " " + markStale)
+	}
+	if mark != "" {
+		fmt.Fprintf(w, " %s", mark)
+	}
+	fmt.Fprintln(w)
+}
+
+// preferWindow is how close in time arrivals must be for --prefer-route to
+// list the preferred route first: within the same minute
+const preferWindow = time.Minute
+
+// markPreferred flags arrivals of a preferred route when styling is disabled
+const markPreferred = "◆"
+
+// preferredRoutes is the set of routes from --prefer-route
+var preferredRoutes map[string]bool
+
+// sortPreferred moves arrivals of the preferred routes ahead of other
+// arrivals in the same minute. Arrivals must already be sorted by time.
+func sortPreferred(arrivals []Arrival) {
+	if len(preferredRoutes) == 0 {
+		return
+	}
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		a, b := arrivals[i].Arrival.Truncate(preferWindow), arrivals[j].Arrival.Truncate(preferWindow)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return preferredRoutes[normalizeRoute(arrivals[i].RouteID)] && !preferredRoutes[normalizeRoute(arrivals[j].RouteID)]
+	})
+}
+
+// displayArrivals writes the arrivals to w as a formatted table
+func displayArrivals(w io.Writer, arrivals []Arrival, stopIDToName map[string]string) {
+	// Sort by arrival time, preferred routes first within a minute
+	sortArrivals(arrivals)
+	sortPreferred(arrivals)
+
+	// Display arrivals with station names; --no-header leaves only the rows
+	if !noHeader {
+		printArrivalHeader(w)
+	}
+	for _, arrival := range arrivals {
+		printArrivalRow(w, arrival, stopIDToName, "")
+	}
+	if noHeader {
+		return
+	}
+	fmt.Fprintf(w, "\nTotal: %d upcoming arrivals\n", len(arrivals))
+	printUnknownStopsNote(w, unknownStopIDs(arrivals, stopIDToName))
+}
+
+// presentRoutes returns the distinct route IDs of the arrivals, sorted
+func presentRoutes(arrivals []Arrival) []string {
+	seen := make(map[string]bool)
+	var routeIDs []string
+	for _, arrival := range arrivals {
+		if !seen[arrival.RouteID] {
+			seen[arrival.RouteID] = true
+			routeIDs = append(routeIDs, arrival.RouteID)
+		}
+	}
+	sort.Strings(routeIDs)
+	return routeIDs
+}
+
+// printRouteLegend writes a legend of the routes among the arrivals, each
+// with its color badge and service name
+func printRouteLegend(w io.Writer, arrivals []Arrival) {
+	routeIDs := presentRoutes(arrivals)
+	if len(routeIDs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nLegend:")
+	for _, routeID := range routeIDs {
+		line := "  " + routeBadge(routeID)
+		if name, ok := routeNames[baseRoute(routeID)]; ok {
+			line += " " + name
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// displayStationGroups writes a separate arrivals table to w for each station
+func displayStationGroups(w io.Writer, groups []StationGroup, stopIDToName map[string]string) {
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Station: %s\n", group.Station)
+		displayArrivals(w, group.Arrivals, stopIDToName)
+	}
+}
+
+// displayGroupedArrivals writes the arrivals to w with a header per route and direction
+func displayGroupedArrivals(w io.Writer, groups []ArrivalGroup, stopIDToName map[string]string) {
+	total := 0
+	var all []Arrival
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		direction := group.Direction
+		if direction == "" {
+			direction = "?"
+		} else if groupDirection {
+			direction = directionLabel(group.RouteID, direction)
+		}
+		fmt.Fprintf(w, "Route %s (%s)\n", group.RouteID, direction)
+		printArrivalHeader(w)
+		for _, arrival := range group.Arrivals {
+			printArrivalRow(w, arrival, stopIDToName, "")
+		}
+		total += len(group.Arrivals)
+		all = append(all, group.Arrivals...)
+	}
+	fmt.Fprintf(w, "\nTotal: %d upcoming arrivals\n", total)
+	printUnknownStopsNote(w, unknownStopIDs(all, stopIDToName))
+}
+
+var (
+	watchMode       bool
+	watchOnce       bool
+	repeatCount     int
+	refreshInterval time.Duration
+	outputPath      string
+	appendOutput    bool
+	dedupeWindow    time.Duration
+	dedupeKeep      string
+	withSchedule    bool
+	vsSchedule      bool
+	perRoute        int
+	groupDirection  bool
+	countOnly       bool
+	failOnEmpty     bool
+	feedAgeExit     time.Duration
+	watchDuration   time.Duration
+	pagerMode       string
+	jsonOutput      bool
+	jsonMeta        bool
+	markdownOutput  bool
+	streamOutput    bool
+	tailMode        bool
+	minMinutes      int
+	secondsBelow    time.Duration
+	routes          []string
+	labels          []string
+	shiftThreshold  time.Duration
+	groupStation    bool
+	compactBoard    bool
+	boardMode       bool
+	splitDirection  bool
+	groupSort       string
+	reversePath     bool
+	onlyStops       []string
+	columnsFlag     []string
+	stdinQueries    bool
+	strictMode      bool
+	excludeStops    []string
+	showLinks       bool
+	showTrip        bool
+	showTrack       bool
+	noHeader        bool
+	byTrip          bool
+	nameWidth       int
+	bothDirections  bool
+	minHeadway      time.Duration
+	showLegend      bool
+	alignRefresh    bool
+	noKeepAlive     bool
+	endpointTimeout time.Duration
+	everyNth        int
+	terminatingAt   string
+	eventMode       string
+	preferRoutes    []string
+	staleAfter      time.Duration
+	tripFilter      string
+	exitCodeMap     bool
+	nowFlag         string
+	use24Hour       bool
+	timeFormat      string
+	asOf            time.Time // parsed --now; zero means the wall clock
+)
+
+// reportError prints an error from the arrivals command to stderr, keeping
+// stdout for the arrivals. In JSON output modes the error is written as
+// {"error": "..."}, so automation can detect failures structurally.
+// Callers then return exitWith(exitError), so the command exits 1 in every
+// mode.
+func reportError(err error) {
+	if jsonOutput || jsonMeta || streamOutput {
+		writeJSONError(os.Stderr, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+}
 
 var arrivalsCmd = &cobra.Command{
 	Use:   "arrivals [station]",
-	Short: "Fetch real-time arrival data for subway lines 1, 2, and 3",
-	Long: `Fetches and displays real-time arrival information for NYC Subway lines 1, 2, and 3.
-Shows stop IDs and arrival times for upcoming trains.
+	Short: "Fetch real-time arrival data for NYC Subway lines",
+	Long: `Fetches and displays real-time arrival information for NYC Subway lines.
+Shows stop IDs and arrival times for upcoming trains on the A Division lines
+(1-7 and the 42 St Shuttle), or on the lines selected with --routes
+(any subway line, shuttle, or the SIR).
 
 Optionally filter by station name or stop ID:
   mta-cli arrivals                              # Show all arrivals
   mta-cli arrivals "116 St-Columbia University" # Filter by station name
   mta-cli arrivals 116N                         # Filter by stop ID
-  mta-cli arrivals 116N --watch                 # Watch mode: continuous updates`,
+  mta-cli arrivals 116                          # Both directions of a parent stop ID
+  mta-cli arrivals 116N --both-directions       # 116N and its opposite platform 116S
+  mta-cli arrivals 116N --watch                 # Watch mode: continuous updates
+  MTA_DEFAULT_STATION=116N mta-cli arrivals -w  # Default station when none is given
+  mta-cli arrivals --routes 4,5,6               # Show arrivals for other lines
+  mta-cli arrivals --routes SI                  # Staten Island Railway
+  mta-cli arrivals --routes reds,7              # Route groups mix with routes
+  mta-cli arrivals --routes 1 --reverse         # One line stop by stop, from the other end
+  mta-cli arrivals 116N --watch-once            # Run a single watch refresh and exit
+  mta-cli arrivals 116N -w --watch-duration 1h  # Watch for an hour, then exit
+  mta-cli arrivals 116N -w --align              # Refresh at :00 and :30, in sync with other screens
+  mta-cli arrivals 116N -w --disable-keepalive  # New connection per fetch, for flaky proxies
+  mta-cli arrivals --routes 1,L --endpoint-timeout 5s  # Skip a feed that takes over 5s
+  mta-cli arrivals 116N --repeat 3 --interval 1m  # Three boards a minute apart, then exit
+  mta-cli arrivals 116N --per-route 2           # Next 2 trains per route and direction
+  mta-cli arrivals 120 --per-route 2 --group-direction  # Headed "Uptown & The Bronx", not N
+  mta-cli arrivals --group-by-station           # One table per station
+  mta-cli arrivals --group-by-station --group-sort next  # Station with the next train first
+  mta-cli arrivals --compact                    # One line per station, for dashboards
+  mta-cli arrivals 120 --split-direction        # Uptown and downtown side by side
+  mta-cli arrivals 120 --board                  # Countdown clock board for 96 St
+  mta-cli arrivals --routes A,C,E --pager never # Don't page long tables
+  mta-cli arrivals --routes A,C,E --legend      # Explain the route colors under the table
+  mta-cli arrivals 116N --count                 # Print only the number of arrivals
+  mta-cli arrivals --feed-age-exit 2m           # Exit 4 if the feed is staler than 2 minutes
+  mta-cli arrivals 116N --min-minutes 3         # Skip trains arriving in under 3 minutes
+  mta-cli arrivals 116N --seconds-threshold 0   # Whole minutes even for imminent trains
+  mta-cli arrivals 127S --prefer-route 1        # Highlight the 1 at a shared platform
+  mta-cli arrivals 116N --min-headway 12m       # Point out gaps in service over 12 minutes
+  mta-cli arrivals "86 St" -r 1 --exclude-stops 121S  # Hide one platform
+  mta-cli arrivals 116N --label 116N=home       # Show a custom label for a stop
+  mta-cli arrivals 116N --columns route,minutes,destination  # Choose the table columns
+  mta-cli arrivals 116N --no-header             # Only the rows, for awk and cut
+  mta-cli arrivals --routes E --name-width 20   # Abbreviate long station names
+  mta-cli arrivals 116N --with-schedule         # Show scheduled times alongside realtime
+  mta-cli arrivals 117S --vs-schedule           # How late each train runs against the timetable
+  mta-cli arrivals 101S --mode from             # Departures from a terminal
+  mta-cli arrivals 116N --24h                   # 24-hour clock times
+  mta-cli arrivals --trip 097550_1..N03R        # Follow one train along its remaining stops
+  mta-cli arrivals --routes 1 --by-trip         # Each train once, at its next stop
+  mta-cli arrivals 120 --terminating-at "South Ferry"  # Only trains ending their run there
+  mta-cli arrivals 116N --json                  # Print arrivals as a JSON array
+  mta-cli arrivals 116N --json-meta             # The array wrapped with feed metadata
+  mta-cli arrivals 116N --markdown              # A Markdown table, for issues and chat
+  mta-cli arrivals 116N --now 2024-05-01T08:30:00-04:00  # Times relative to a fixed instant
+  cat stations.txt | mta-cli arrivals --stdin   # A board per station in the list
+  mta-cli arrivals 116N --watch --stream        # Stream JSON Lines on every refresh
+  mta-cli arrivals 116N --watch --tail          # A line per newly predicted train
+  mta-cli arrivals 116N -w --stream --every-nth 10  # Log every 10th refresh (every 5 min)
+  mta-cli arrivals 116N --json -o out.json      # Write the output to a file
+
+Exit status with --exit-code-map (the first that applies wins):
+  5  the feed could not be fetched
+  4  the feed is older than --feed-age-exit
+  2  the station doesn't exist or is ambiguous
+  3  no matching arrivals
+  0  arrivals found
+Other errors exit 1. Without --exit-code-map, only --fail-on-empty (1),
+--strict (2), and --feed-age-exit (4) change the exit status.`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		// If watch mode is enabled, require a station argument
-		if watchMode && len(args) == 0 {
-			fmt.Println("Error: watch mode requires a station name or stop ID")
-			fmt.Println("Usage: mta-cli arrivals [station] --watch")
-			return
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Errors are reported as they happen; a returned error only
+		// carries the exit status
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		// The settings below are derived from the flags rather than written
+		// back to them, so a later run in the same process starts clean.
+		// A single watch iteration behaves like watch mode in every other
+		// respect, and the metadata envelope is a variant of the JSON output.
+		watch := watchMode || watchOnce
+		asJSON := jsonOutput || jsonMeta
+		both := bothDirections
+
+		// Route groups such as reds stand for their routes everywhere below
+		selectedRoutes := expandRouteGroups(routes)
+		preferredRoutes = nil
+		if len(preferRoutes) > 0 {
+			preferredRoutes = routeSet(expandRouteGroups(preferRoutes))
 		}
 
-		// Load stop mappings
-		stopIDToName, nameToIDs, err := LoadStopMaps("gtfs_subway/stops.csv")
+		// Load config; the station default and custom labels come from it
+		config, err := LoadConfig(configPath)
 		if err != nil {
-			fmt.Printf("Warning: Could not load stop names: %v\n", err)
-			fmt.Println("Will display stop IDs only.")
+			reportError(err)
+			return exitWith(exitError)
 		}
+		applyFeedConfigs(config.Feeds)
 
-		// Get station filter if provided
+		// Catch unknown routes before anything is fetched
+		if len(selectedRoutes) > 0 {
+			if _, err := feedsForRoutes(selectedRoutes); err != nil {
+				reportError(err)
+				return exitWith(exitError)
+			}
+		}
+
+		// A trip is followed across all its stops, so no station applies
+		if tripFilter != "" && (len(args) > 0 || stdinQueries) {
+			reportError(errors.New("--trip cannot be combined with a station argument or --stdin"))
+			return exitWith(exitError)
+		}
+
+		// Get station filter: the argument, then the environment, then the
+		// config file; batch queries read their stations from stdin instead
 		var station string
-		if len(args) > 0 {
-			station = args[0]
+		if !stdinQueries && tripFilter == "" {
+			station = defaultStation(args, os.Getenv(defaultStationEnv), config)
 		}
 
-		// Function to fetch, filter, and display arrivals
-		fetchAndDisplay := func() {
-			// Fetch the feed
-			arrivals, err := fetchFeed()
+		// If watch mode is enabled, require a station or a trip
+		if watch && station == "" && tripFilter == "" {
+			reportError(errors.New("watch mode requires a station name or stop ID"))
+			fmt.Fprintln(os.Stderr, "Usage: mta-cli arrivals [station] --watch")
+			return exitWith(exitError)
+		}
+
+		// The board preset shows both directions of a single station
+		if boardMode {
+			if station == "" {
+				reportError(errors.New("--board requires a station name or stop ID"))
+				fmt.Fprintln(os.Stderr, "Usage: mta-cli arrivals <station> --board")
+				return exitWith(exitError)
+			}
+			if asJSON || markdownOutput || streamOutput || countOnly {
+				reportError(errors.New("--board cannot be combined with --json, --markdown, --stream, or --count"))
+				return exitWith(exitError)
+			}
+			both = true
+		}
+
+		// Streaming only makes sense as part of watch mode
+		if streamOutput && !watch {
+			reportError(errors.New("--stream requires --watch"))
+			fmt.Fprintln(os.Stderr, "Usage: mta-cli arrivals [station] --watch --stream")
+			return exitWith(exitError)
+		}
+
+		// Tail mode prints its own lines as watch mode finds new arrivals
+		if tailMode && !watch {
+			reportError(errors.New("--tail requires --watch"))
+			fmt.Fprintln(os.Stderr, "Usage: mta-cli arrivals [station] --watch --tail")
+			return exitWith(exitError)
+		}
+		if tailMode && (streamOutput || asJSON || countOnly || boardMode || compactBoard || splitDirection || groupStation || perRoute > 0) {
+			reportError(errors.New("--tail cannot be combined with --stream, --json, --count, or a grouped layout"))
+			return exitWith(exitError)
+		}
+
+		if markdownOutput && (asJSON || streamOutput || countOnly || tailMode) {
+			reportError(errors.New("--markdown cannot be combined with --json, --stream, --count, or --tail"))
+			return exitWith(exitError)
+		}
+
+		if asOf, err = parseAsOf(nowFlag); err != nil {
+			reportError(err)
+			return exitWith(exitError)
+		}
+
+		if err := setClockLayout(use24Hour, timeFormat); err != nil {
+			reportError(err)
+			return exitWith(exitError)
+		}
+
+		if watchDuration < 0 {
+			reportError(errors.New("--watch-duration must not be negative"))
+			return exitWith(exitError)
+		}
+
+		if alignRefresh && (!watch || watchOnce) {
+			reportError(errors.New("--align requires --watch"))
+			return exitWith(exitError)
+		}
+		if alignRefresh && refreshInterval <= 0 {
+			reportError(errors.New("--interval must be positive to --align refreshes"))
+			return exitWith(exitError)
+		}
+		if endpointTimeout < 0 {
+			reportError(errors.New("--endpoint-timeout must not be negative"))
+			return exitWith(exitError)
+		}
+		if everyNth < 1 {
+			reportError(errors.New("--every-nth must be at least 1"))
+			return exitWith(exitError)
+		}
+		if everyNth > 1 && (!watch || watchOnce) {
+			reportError(errors.New("--every-nth requires --watch"))
+			return exitWith(exitError)
+		}
+
+		if secondsBelow < 0 {
+			reportError(errors.New("--seconds-threshold must not be negative"))
+			return exitWith(exitError)
+		}
+
+		if minHeadway < 0 {
+			reportError(errors.New("--min-headway must not be negative"))
+			return exitWith(exitError)
+		}
+
+		if jsonMeta && (stdinQueries || streamOutput) {
+			reportError(errors.New("--json-meta cannot be combined with --stdin or --stream"))
+			return exitWith(exitError)
+		}
+
+		// Batch queries replace the station argument
+		if stdinQueries && (len(args) > 0 || watch) {
+			reportError(errors.New("--stdin cannot be combined with a station argument or --watch"))
+			return exitWith(exitError)
+		}
+
+		// Repeating is a one-shot query run several times
+		if repeatCount < 1 {
+			reportError(errors.New("--repeat must be at least 1"))
+			return exitWith(exitError)
+		}
+		if repeatCount > 1 && (watch || stdinQueries) {
+			reportError(errors.New("--repeat cannot be combined with --watch or --stdin"))
+			return exitWith(exitError)
+		}
+
+		// The feed age check is a one-shot probe
+		if feedAgeExit > 0 && watch {
+			reportError(errors.New("--feed-age-exit cannot be used with --watch"))
+			return exitWith(exitError)
+		}
+
+		if byTrip && tripFilter != "" {
+			reportError(errors.New("--by-trip cannot be combined with --trip"))
+			return exitWith(exitError)
+		}
+
+		if perRoute < 0 {
+			reportError(errors.New("--per-route must be at least 0"))
+			return exitWith(exitError)
+		}
+		if groupDirection && perRoute <= 0 {
+			reportError(errors.New("--group-direction requires --per-route"))
+			return exitWith(exitError)
+		}
+
+		if groupSort != "name" && groupSort != "next" {
+			reportError(fmt.Errorf("invalid --group-sort %q, expected next or name", groupSort))
+			return exitWith(exitError)
+		}
+
+		if err := validatePagerMode(pagerMode); err != nil {
+			reportError(err)
+			return exitWith(exitError)
+		}
+
+		if eventMode != "at" && eventMode != "from" {
+			reportError(fmt.Errorf("invalid --mode %q, expected at or from", eventMode))
+			return exitWith(exitError)
+		}
+		if dedupeKeep != "earlier" && dedupeKeep != "later" {
+			reportError(fmt.Errorf("invalid --dedupe-keep %q, expected earlier or later", dedupeKeep))
+			return exitWith(exitError)
+		}
+
+		// Load custom labels; flags take precedence over the config file
+		flagLabels, err := parseLabels(labels)
+		if err != nil {
+			reportError(err)
+			return exitWith(exitError)
+		}
+
+		// Load stop mappings
+		stopIDToName, nameToIDs, err := CachedStopMaps(stopsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not load stop names: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Will display stop IDs only.")
+		}
+		stopIDToName = applyLabels(stopIDToName, config.Labels, flagLabels)
+
+		// Load stop details, used to expand parent stop IDs and to link stations
+		stops, err := CachedStops(stopsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not load stop details: %v\n", err)
+		}
+		index := StopIndex{
+			StopIDToName: stopIDToName,
+			NameToIDs:    nameToIDs,
+			Children:     childStops(stops),
+			Stops:        stops,
+		}
+
+		// Link station names to maps; terminals that don't support OSC 8 and
+		// pipes would show the escape codes, so only enable links on a TTY
+		if showLinks && isTerminal(os.Stdout) {
+			stopLinks = mapLinks(stops)
+		}
+
+		// Resolve the terminal the trips must end at
+		var terminalStops []string
+		if terminatingAt != "" {
+			terminalStops, err = resolveStops(terminatingAt, selectedRoutes, index)
 			if err != nil {
-				fmt.Printf("Error fetching feed: %v\n", err)
+				reportError(fmt.Errorf("--terminating-at: %w", err))
+				return exitWith(exitError)
+			}
+		}
+
+		// Load the static schedule for the requested stops
+		var schedule *Schedule
+		if withSchedule || vsSchedule {
+			if station == "" {
+				option := "--with-schedule"
+				if !withSchedule {
+					option = "--vs-schedule"
+				}
+				reportError(fmt.Errorf("%s requires a station name or stop ID", option))
+				return exitWith(exitError)
+			}
+			stopIDs, err := resolveStops(station, selectedRoutes, index)
+			if err != nil {
+				reportError(err)
+				return exitWith(exitError)
+			}
+			schedule, err = LoadSchedule(staticSource(cmd, "stop_times.txt", true), stopIDs)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Could not load the static schedule: %v\n", err)
+				if withSchedule {
+					fmt.Fprintln(os.Stderr, "Will display realtime arrivals only.")
+				}
+			}
+		}
+
+		// A single line without a station is shown stop by stop along the line
+		var routePath []string
+		if len(selectedRoutes) == 1 && station == "" && tripFilter == "" && !stdinQueries && !boardMode && !compactBoard && !splitDirection && !groupStation && perRoute == 0 && !noHeader && !byTrip && !markdownOutput {
+			stopIDs, err := LoadRouteStops(staticSource(cmd, "stop_times.txt", reversePath), normalizeRoute(selectedRoutes[0]))
+			if err != nil {
+				// The schedule files are optional, so only mention them when asked to
+				if reversePath || !errors.Is(err, os.ErrNotExist) {
+					fmt.Fprintf(os.Stderr, "Warning: Could not load the stop order of route %s: %v\n", normalizeRoute(selectedRoutes[0]), err)
+				}
+			} else {
+				routePath = stationPath(stopIDs, stops, reversePath)
+			}
+		}
+
+		// Write rendered output to a file if requested, otherwise to stdout
+		var out io.Writer = os.Stdout
+		if outputPath != "" {
+			file, err := openOutput(outputPath, appendOutput)
+			if err != nil {
+				reportError(err)
+				return exitWith(exitError)
+			}
+			defer file.Close()
+			out = file
+		}
+		toStdout := outputPath == ""
+
+		// Resolve the table layout
+		columnNames := defaultColumns
+		if len(columnsFlag) > 0 {
+			columnNames = columnsFlag
+		}
+		if showTrip {
+			columnNames = append(append([]string{}, columnNames...), "trip")
+		}
+		if showTrack {
+			columnNames = append(append([]string{}, columnNames...), "track")
+		}
+		// A train listed once is told apart by where it's headed
+		if len(columnsFlag) == 0 && byTrip {
+			columnNames = append(append([]string{}, columnNames...), "direction", "destination")
+		}
+		if len(columnsFlag) == 0 && vsSchedule {
+			columnNames = append(append([]string{}, columnNames...), "vs_schedule")
+		}
+		// How far off a train is only means something for a single station
+		if len(columnsFlag) == 0 && (station != "" || stdinQueries) && tripFilter == "" {
+			columnNames = append(append([]string{}, columnNames...), "stops_away")
+		}
+		tableColumns, err = selectColumns(columnNames)
+		if err != nil {
+			reportError(err)
+			return exitWith(exitError)
+		}
+		if eventMode == "from" {
+			for i := range tableColumns {
+				if tableColumns[i].Name == "arrival" {
+					tableColumns[i].Header = "DEPARTURE_TIME"
+				}
+			}
+		}
+		if nameWidth != 0 {
+			if nameWidth < minNameWidth {
+				reportError(fmt.Errorf("--name-width must be at least %d", minNameWidth))
+				return exitWith(exitError)
+			}
+			tableColumns = withNameWidth(tableColumns, nameWidth)
+		}
+
+		// Color routes only when the destination is a terminal, unless forced
+		colorOutput = useColor(out)
+
+		// Buffer a one-shot table for the pager; machine-readable and piped
+		// output are never paged
+		var paged *bytes.Buffer
+		if pagerMode != pagerNever && toStdout && isTerminal(os.Stdout) && !watch && repeatCount == 1 && !asJSON && !markdownOutput && !countOnly {
+			paged = &bytes.Buffer{}
+			out = paged
+		}
+
+		// State of the latest refresh, kept so that watch mode can re-render
+		// the board between fetches without hitting the network
+		var (
+			fetchErr     error
+			filterErr    error           // from resolving the station query
+			writeErr     error           // from writing JSON output
+			arrivals     []Arrival       // every upcoming arrival on the requested routes
+			filtered     []Arrival       // arrivals matching the filters
+			previous     []Arrival       // filtered arrivals from the previous refresh
+			changes      *ArrivalChanges // changes since the previous refresh, in watch mode
+			lastUpdated  time.Time
+			feedTime     time.Time // header timestamp of the stalest feed
+			rerouted     []string  // routes with detoured trips
+			stopsChecked bool      // whether --only-stops/--exclude-stops were validated
+			fetchTime    time.Duration
+			// Arrivals printed by --tail, with their predicted times
+			tailSeen map[string]time.Time
+		)
+
+		// Show a spinner during the first fetch, but only for interactive
+		// table output; machine-readable and piped output stay untouched
+		showSpinner := toStdout && isTerminal(os.Stdout) && !asJSON && !streamOutput && !markdownOutput && !countOnly
+
+		// Shared across refreshes so unchanged feeds aren't downloaded again
+		// and, unless --disable-keepalive is set, connections are reused
+		feedClient := NewFeedClient(newHTTPClient(noKeepAlive))
+
+		// refresh fetches the feed and applies the filters
+		var applyFilters func(now time.Time)
+		refresh := func() {
+			// Fetch the feed
+			now := currentTime()
+			var spinner *Spinner
+			if showSpinner && lastUpdated.IsZero() {
+				spinner = startSpinner("Fetching arrivals...")
+			}
+			snapshot, err := FetchSnapshot(cmd.Context(), ArrivalsOptions{Routes: selectedRoutes, Now: now, FeedClient: feedClient, Departures: eventMode == "from", EndpointTimeout: endpointTimeout})
+			spinner.Stop()
+			if fetchErr = err; fetchErr != nil {
 				return
 			}
+			for _, feed := range snapshot.TimedOut {
+				fmt.Fprintf(os.Stderr, "Warning: the %s feed did not answer within %s; its arrivals are missing\n", feed, endpointTimeout)
+			}
+			arrivals = snapshot.Arrivals
+			feedTime = snapshot.Timestamp
+			rerouted = snapshot.Rerouted
+			fetchTime = snapshot.FetchTime()
+			lastUpdated = now
+			if verbose {
+				logFeedStats(snapshot.Stats)
+			}
+			applyFilters(now)
+		}
+
+		// applyFilters filters the latest batch for the current station
+		applyFilters = func(now time.Time) {
+			// Merge near-identical predictions
+			arrivals = dedupeArrivals(arrivals, dedupeWindow, dedupeKeep == "later")
+
+			// Apply the station and route filters
+			filtered, filterErr = filterArrivals(arrivals, station, selectedRoutes, index, both)
+
+			// Follow a single train
+			if tripFilter != "" {
+				filtered = filterTrip(filtered, tripFilter)
+			}
+
+			// Keep trains that end their run at the terminal
+			if terminatingAt != "" {
+				filtered = filterTerminatingAt(filtered, terminalStops, index.Stops)
+			}
+
+			// Compare realtime predictions with the schedule
+			if vsSchedule && schedule != nil {
+				schedule.Annotate(filtered)
+			}
+
+			// Show scheduled arrivals alongside realtime ones
+			if withSchedule && schedule != nil && filterErr == nil {
+				var wantedRoutes map[string]bool
+				if len(selectedRoutes) > 0 {
+					wantedRoutes = routeSet(selectedRoutes)
+				}
+				filtered = append(filtered, schedule.Arrivals(wantedRoutes, now, scheduleHorizon)...)
+			}
+
+			// Narrow the result to specific stops
+			if len(onlyStops) > 0 || len(excludeStops) > 0 {
+				if !stopsChecked {
+					warnUnseenStops(append(append([]string{}, onlyStops...), excludeStops...), arrivals, index)
+					stopsChecked = true
+				}
+				filtered = filterStops(filtered, expandStopIDs(onlyStops, index), expandStopIDs(excludeStops, index))
+			}
+
+			// Drop trains that are too close to catch
+			if minMinutes > 0 {
+				filtered = filterMinMinutes(filtered, now, minMinutes)
+			}
+
+			// Show each train once
+			if byTrip {
+				filtered = firstPerTrip(filtered)
+			}
+
+			// In watch mode, track what changed since the previous refresh
+			if watch {
+				if previous != nil {
+					diff := diffArrivals(previous, filtered, shiftThreshold)
+					changes = &diff
+				}
+				previous = append([]Arrival{}, filtered...)
+			}
+		}
+
+		// render displays the latest refresh.
+		// Returns the number of matching arrivals.
+		render := func() int {
+			if fetchErr != nil {
+				// Keep JSON output on stdout free of anything but JSON
+				if asJSON || streamOutput {
+					writeJSONError(os.Stderr, fmt.Errorf("error fetching feed: %w", fetchErr))
+				} else {
+					fmt.Fprintf(out, "Error fetching feed: %v\n", fetchErr)
+				}
+				return 0
+			}
+
+			// An ambiguous station can't be shown; list the candidates instead.
+			// In strict mode, an unknown station is an error too rather than
+			// an empty board.
+			var ambiguous *AmbiguousStationError
+			var duplicate *DuplicateStationError
+			var notFound *StationNotFoundError
+			if errors.As(filterErr, &ambiguous) || errors.As(filterErr, &duplicate) ||
+				(strictMode && errors.As(filterErr, &notFound)) {
+				if asJSON || streamOutput {
+					writeJSONError(os.Stderr, filterErr)
+				} else {
+					fmt.Fprintf(out, "Error: %v\n", filterErr)
+				}
+				return 0
+			}
+
+			// In count mode, print only the number of matching arrivals
+			if countOnly {
+				fmt.Fprintln(out, len(filtered))
+				return len(filtered)
+			}
+
+			// In tail mode, print only the arrivals not seen before, with the
+			// header above the first batch
+			if tailMode {
+				header := tailSeen == nil
+				if header {
+					tailSeen = make(map[string]time.Time)
+				}
+				printTailLines(out, newArrivals(tailSeen, filtered, lastUpdated), stopIDToName, lastUpdated, header)
+				return len(filtered)
+			}
+
+			// Machine-readable output modes
+			if streamOutput {
+				if err := writeArrivalsJSONLines(out, filtered, stopIDToName, lastUpdated); err != nil {
+					writeJSONError(os.Stderr, err)
+					writeErr = err
+				}
+				return len(filtered)
+			}
+			if jsonMeta {
+				envelope := newArrivalsEnvelope(filtered, stopIDToName, station, selectedRoutes, feedTime, lastUpdated)
+				if err := writeArrivalsEnvelope(out, envelope); err != nil {
+					reportError(err)
+					writeErr = err
+				}
+				return len(filtered)
+			}
+			if asJSON {
+				if err := writeArrivalsJSON(out, filtered, stopIDToName); err != nil {
+					reportError(err)
+					writeErr = err
+				}
+				return len(filtered)
+			}
+			if markdownOutput {
+				writeArrivalsMarkdown(out, filtered, stopIDToName, currentTime())
+				return len(filtered)
+			}
 
 			if len(arrivals) == 0 {
-				fmt.Println("No upcoming arrivals found.")
-				return
+				fmt.Fprintln(out, "No upcoming arrivals found.")
+				return 0
 			}
 
-			// Apply filtering if station argument provided
-			var filteredArrivals []Arrival
-			if station != "" {
-				filteredArrivals = filterArrivals(arrivals, station, nameToIDs)
-				if len(filteredArrivals) == 0 {
-					fmt.Printf("No arrivals found for station: %s\n", station)
-					return
+			if len(filtered) == 0 && tripFilter != "" {
+				fmt.Fprintf(out, "No arrivals found for trip: %s\n", tripFilter)
+				return 0
+			}
+
+			if len(filtered) == 0 {
+				fmt.Fprintf(out, "No arrivals found for station: %s\n", station)
+				if errors.As(filterErr, &notFound) && len(notFound.Suggestions) > 0 {
+					fmt.Fprintf(out, "Did you mean: %s?\n", strings.Join(notFound.Suggestions, ", "))
 				}
+				return 0
+			}
+
+			if tripFilter != "" {
+				printTripHeading(out, filtered, stopIDToName)
+			}
+
+			// Display arrivals, optionally grouped by station or by route and direction.
+			// In watch mode, highlight what changed since the previous refresh.
+			if boardMode {
+				displayBoard(out, stationGroups(filtered, stopIDToName), stopIDToName, currentTime())
+			} else if compactBoard {
+				displayCompact(out, stationGroups(filtered, stopIDToName), currentTime())
+			} else if splitDirection {
+				displaySplitDirection(out, stationGroups(filtered, stopIDToName), currentTime())
+			} else if groupStation {
+				displayStationGroups(out, stationGroups(filtered, stopIDToName), stopIDToName)
+			} else if perRoute > 0 {
+				displayGroupedArrivals(out, groupByRouteDirection(filtered, perRoute), stopIDToName)
+			} else if len(routePath) > 0 {
+				displayRoutePath(out, normalizeRoute(selectedRoutes[0]), routePath, filtered, stopIDToName, stops, currentTime())
+			} else if changes != nil && !noHeader {
+				displayChangedArrivals(out, filtered, stopIDToName, *changes)
 			} else {
-				filteredArrivals = arrivals
+				displayArrivals(out, filtered, stopIDToName)
+			}
+
+			if showLegend {
+				printRouteLegend(out, filtered)
+			}
+
+			// Mention detours, for feeds that publish them
+			if len(rerouted) > 0 {
+				fmt.Fprintf(out, "\nNote: %s\n", formatRerouted(rerouted))
 			}
 
-			// Display arrivals
-			displayArrivals(filteredArrivals, stopIDToName)
+			// Warn about irregular service
+			if minHeadway > 0 {
+				printHeadwayGaps(out, findHeadwayGaps(filtered, minHeadway), stopIDToName, currentTime())
+			}
+			return len(filtered)
 		}
 
-		if watchMode {
-			// Watch mode: continuous updates
-			ticker := time.NewTicker(30 * time.Second)
-			defer ticker.Stop()
+		// outcomeOf classifies the latest refresh for the exit status.
+		// Scripts can tell an unknown station from one with no trains.
+		outcomeOf := func(count int, staleErr error) arrivalsOutcome {
+			switch {
+			case fetchErr != nil:
+				return outcomeFetchError
+			case staleErr != nil:
+				return outcomeStale
+			case filterErr != nil:
+				return outcomeUnknownStation
+			case count == 0:
+				return outcomeEmpty
+			}
+			return outcomeArrivals
+		}
 
-			// Clear screen function
+		// Function to fetch, filter, and display arrivals.
+		// Returns the number of matching arrivals.
+		fetchAndDisplay := func() int {
+			refresh()
+			return render()
+		}
+
+		if stdinQueries {
+			// Batch mode: fetch once, then filter and render per query
+			queries, err := readQueries(os.Stdin)
+			if err != nil {
+				reportError(err)
+				return exitWith(exitError)
+			}
+			if len(queries) == 0 {
+				return nil
+			}
+
+			station = queries[0]
+			refresh()
+			if fetchErr != nil {
+				render()
+				if paged != nil {
+					pageOutput(paged.Bytes(), pagerMode)
+				}
+				if exitCodeMap {
+					return exitWith(exitFetchError)
+				}
+				return exitWith(exitError)
+			}
+
+			var results []batchResult
+			total := 0
+			unresolved := false
+			for i, query := range queries {
+				if i > 0 {
+					station = query
+					applyFilters(lastUpdated)
+				}
+				if filterErr != nil {
+					unresolved = true
+				}
+				if asJSON {
+					results = append(results, newBatchResult(query, filtered, filterErr, stopIDToName))
+					total += len(filtered)
+					continue
+				}
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				fmt.Fprintf(out, "== %s ==\n", query)
+				total += render()
+			}
+
+			if asJSON {
+				if err := writeBatchJSON(out, results); err != nil {
+					reportError(err)
+					return exitWith(exitError)
+				}
+			}
+			if paged != nil {
+				pageOutput(paged.Bytes(), pagerMode)
+			}
+			outcome := outcomeArrivals
+			if unresolved {
+				outcome = outcomeUnknownStation
+			} else if total == 0 {
+				outcome = outcomeEmpty
+			}
+			return exitWith(exitCode(outcome, total))
+		}
+
+		if watch {
+			// Clear screen function; output files are logs, so never clear them
+			clear := screenClearer(os.Stdout, enableEscapes(os.Stdout))
 			clearScreen := func() {
-				fmt.Print("\033[H\033[2J") // ANSI escape codes to clear terminal
+				if toStdout {
+					clear()
+				}
+			}
+
+			// When rate limited, fetching pauses until pausedUntil
+			var pausedUntil time.Time
+			rateLimits := 0    // consecutive rate limited fetches
+			failedFetches := 0 // consecutive failed fetches, for the health line
+
+			// Streams and tails are append-only: the screen is never
+			// cleared for them and there is no footer
+			appendOnly := streamOutput || tailMode
+
+			// Footer shown below the board, omitted when appending
+			watchStart := time.Now()
+			printFooter := func() {
+				if appendOnly {
+					return
+				}
+				fmt.Fprintf(out, "\nLast updated: %s (fetched in %s, running for %s)\n",
+					formatClockSeconds(lastUpdated), fetchTime.Round(time.Millisecond), time.Since(watchStart).Round(time.Second))
+				if watchOnce {
+					return
+				}
+				fmt.Fprintln(out, "Watch mode active. Press Ctrl+C to exit.")
+				fmt.Fprintln(out, formatHealth(failedFetches))
+				if !pausedUntil.IsZero() {
+					fmt.Fprintf(out, "Rate limited by the feed endpoint; pausing until %s...\n", formatClockSeconds(pausedUntil))
+				} else {
+					aligned := ""
+					if alignRefresh {
+						aligned = ", aligned to the clock"
+					}
+					fmt.Fprintf(out, "Refreshing every %s%s...\n", refreshInterval, aligned)
+				}
+				if watchDuration > 0 {
+					fmt.Fprintf(out, "Stopping at %s.\n", formatClockSeconds(watchStart.Add(watchDuration)))
+				}
+			}
+
+			// watchIteration runs a single watch refresh.
+			// Output files and streams are logs: with --every-nth they
+			// record only every Nth refresh, while the feed is still
+			// fetched on every tick.
+			refreshes := 0
+			logging := streamOutput || !toStdout
+			watchIteration := func(first bool) {
+				record := !logging || refreshes%everyNth == 0
+				if !first && !appendOnly {
+					clearScreen()
+				}
+				if record {
+					fetchAndDisplay()
+				} else {
+					refresh()
+				}
+				refreshes++
+				if fetchErr != nil {
+					failedFetches++
+				} else {
+					failedFetches = 0
+				}
+
+				// Back off instead of making a rate limit worse
+				var limited *RateLimitError
+				if errors.As(fetchErr, &limited) {
+					rateLimits++
+					pausedUntil = time.Now().Add(rateLimitBackoff(limited, refreshInterval, rateLimits))
+					if streamOutput {
+						fmt.Fprintf(os.Stderr, "Rate limited; pausing until %s\n", formatClockSeconds(pausedUntil))
+					}
+				} else {
+					rateLimits = 0
+					pausedUntil = time.Time{}
+				}
+				if record {
+					printFooter()
+				}
+			}
+
+			// nextFetch returns how long to wait before the next fetch
+			nextFetch := func() time.Duration {
+				if !pausedUntil.IsZero() {
+					// Tickers need a positive duration
+					return max(time.Until(pausedUntil), time.Second)
+				}
+				if alignRefresh {
+					return alignDelay(time.Now(), refreshInterval)
+				}
+				return refreshInterval
 			}
 
 			// Initial fetch and display
-			fetchAndDisplay()
-			fmt.Printf("\nLast updated: %s\n", time.Now().Format("3:04:05 PM"))
-			fmt.Println("Watch mode active. Press Ctrl+C to exit.")
-			fmt.Println("Refreshing every 30 seconds...")
-
-			// Continuous updates
-			for range ticker.C {
-				clearScreen()
-				fetchAndDisplay()
-				fmt.Printf("\nLast updated: %s\n", time.Now().Format("3:04:05 PM"))
-				fmt.Println("Watch mode active. Press Ctrl+C to exit.")
-				fmt.Println("Refreshing every 30 seconds...")
+			watchIteration(true)
+			if watchOnce {
+				if writeErr != nil {
+					return exitWith(exitError)
+				}
+				// A single refresh can serve as a monitoring probe too
+				return exitWith(exitCode(outcomeOf(len(filtered), nil), len(filtered)))
+			}
+			if strictMode && filterErr != nil {
+				return exitWith(exitUnknownStation)
+			}
+
+			// Watch mode: fetch on the refresh interval, and re-render the
+			// cached batch every second in between so the minutes-away
+			// countdown stays current. Streams and files only get fetches.
+			ticker := time.NewTicker(nextFetch())
+			defer ticker.Stop()
+			var countdown <-chan time.Time
+			if !appendOnly && toStdout {
+				countdownTicker := time.NewTicker(time.Second)
+				defer countdownTicker.Stop()
+				countdown = countdownTicker.C
+			}
+
+			// Stop after --watch-duration or on Ctrl+C, whichever comes first
+			var expired <-chan time.Time
+			if watchDuration > 0 {
+				expired = time.After(watchDuration)
+			}
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(interrupt)
+
+			for {
+				select {
+				case <-ticker.C:
+					watchIteration(false)
+					ticker.Reset(nextFetch())
+				case <-countdown:
+					clearScreen()
+					render()
+					printFooter()
+				case <-expired:
+					// Keep streams pure JSON by writing the summary to stderr
+					summary := io.Writer(out)
+					if streamOutput {
+						summary = os.Stderr
+					}
+					fmt.Fprintf(summary, "\nWatch stopped after %s: %d refreshes, %d arrivals in the last one.\n",
+						watchDuration, refreshes, len(filtered))
+					return nil
+				case <-interrupt:
+					return nil
+				}
 			}
 		} else {
-			// One-time fetch and display
-			fetchAndDisplay()
+			// One-time fetch and display, or --repeat times in a row with
+			// --interval in between and each result below the previous one.
+			// Ctrl+C during a pause stops repeating.
+			ctx := cmd.Context()
+			if repeatCount > 1 {
+				var stop context.CancelFunc
+				ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+			}
+			pause := func() bool {
+				timer := time.NewTimer(refreshInterval)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+			count := fetchAndDisplay()
+			for i := 1; i < repeatCount && pause(); i++ {
+				if !asJSON && !countOnly {
+					fmt.Fprintln(out)
+				}
+				count = fetchAndDisplay()
+			}
+			if paged != nil {
+				pageOutput(paged.Bytes(), pagerMode)
+			}
+			if writeErr != nil {
+				return exitWith(exitError)
+			}
+			// As a monitoring probe, fail on stale data even if there are arrivals
+			var staleErr error
+			if fetchErr == nil && feedAgeExit > 0 {
+				if staleErr = checkFeedAge(feedTime, lastUpdated, feedAgeExit); staleErr != nil {
+					if asJSON {
+						writeJSONError(os.Stderr, staleErr)
+					} else {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", staleErr)
+					}
+				}
+			}
+			return exitWith(exitCode(outcomeOf(count, staleErr), count))
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(arrivalsCmd)
-	arrivalsCmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Watch mode: continuously update arrivals every 30 seconds")
+	arrivalsCmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Watch mode: continuously update arrivals")
+	arrivalsCmd.Flags().DurationVar(&refreshInterval, "interval", 30*time.Second, "How often watch mode fetches the feed, or the pause between --repeat runs")
+	arrivalsCmd.Flags().IntVar(&repeatCount, "repeat", 1, "Run the query N times, --interval apart, printing each result in turn (no watch screen)")
+	arrivalsCmd.Flags().DurationVar(&watchDuration, "watch-duration", 0, "In watch mode, exit after this long, e.g. 1h (0 runs until interrupted)")
+	arrivalsCmd.Flags().BoolVar(&noKeepAlive, "disable-keepalive", false, "Open a new connection for every feed request instead of reusing one, for proxies that drop persistent connections")
+	arrivalsCmd.Flags().DurationVar(&endpointTimeout, "endpoint-timeout", 0, "Leave out any feed that takes longer than this, showing the others with a warning (0 waits up to the 30s request timeout)")
+	arrivalsCmd.Flags().BoolVar(&alignRefresh, "align", false, "In watch mode, refresh on multiples of --interval on the clock, e.g. at :00 and :30 for 30s")
+	arrivalsCmd.Flags().IntVar(&everyNth, "every-nth", 1, "In watch mode, write only every Nth refresh to --output or --stream")
+	arrivalsCmd.Flags().BoolVar(&watchOnce, "watch-once", false, "Run a single watch mode refresh and exit")
+	arrivalsCmd.Flags().IntVar(&perRoute, "per-route", 0, "Show only the next N arrivals for each route and direction")
+	arrivalsCmd.Flags().BoolVar(&groupDirection, "group-direction", false, "With --per-route, name directions as the station signs do, e.g. Uptown & The Bronx")
+	arrivalsCmd.Flags().BoolVar(&countOnly, "count", false, "Print only the number of matching upcoming arrivals")
+	arrivalsCmd.Flags().BoolVar(&strictMode, "strict", false, "Treat an unknown or ambiguous station as an error and exit with status 2")
+	arrivalsCmd.Flags().BoolVar(&exitCodeMap, "exit-code-map", false, "Exit with a distinct status per outcome: 0 arrivals, 2 unknown station, 3 none, 4 stale feed, 5 fetch error")
+	arrivalsCmd.Flags().BoolVar(&failOnEmpty, "fail-on-empty", false, "Exit with status 1 when no upcoming arrivals match after all filters (one-shot, --watch-once, and --stdin)")
+	arrivalsCmd.Flags().DurationVar(&feedAgeExit, "feed-age-exit", 0, "Exit with status 4 if the feed data is older than this, e.g. 2m (for monitoring); a failed fetch exits with status 1, or 5 with --exit-code-map")
+	arrivalsCmd.Flags().StringVar(&pagerMode, "pager", pagerAuto, "Page long tables through $PAGER: auto (when taller than the terminal), always, or never")
+	arrivalsCmd.Flags().BoolVar(&stdinQueries, "stdin", false, "Read station queries from stdin, one per line, and show a board per query")
+	arrivalsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print arrivals as a JSON array")
+	arrivalsCmd.Flags().BoolVar(&jsonMeta, "json-meta", false, "Print arrivals as a JSON object with the feed timestamp, fetch time, and query (implies --json)")
+	arrivalsCmd.Flags().BoolVar(&markdownOutput, "markdown", false, "Print arrivals as a GitHub-flavored Markdown table of the selected columns")
+	arrivalsCmd.Flags().BoolVar(&streamOutput, "stream", false, "With --watch, print one JSON object per arrival on every refresh")
+	arrivalsCmd.Flags().BoolVar(&tailMode, "tail", false, "With --watch, print a line for each arrival when it first appears instead of redrawing the board")
+	arrivalsCmd.Flags().StringSliceVarP(&routes, "routes", "r", nil, "Routes to show, e.g. 1,2,3 or A,C,E (S for the 42 St Shuttle, SI for the SIR), or groups: numbered, lettered, reds, greens, blues, oranges, browns, yellows; defaults to all A Division routes")
+	arrivalsCmd.Flags().StringArrayVar(&labels, "label", nil, "Custom label for a stop ID as id=name (repeatable, overrides the config file)")
+	arrivalsCmd.Flags().DurationVar(&shiftThreshold, "shift-threshold", time.Minute, "In watch mode, mark arrivals whose predicted time moved by more than this")
+	arrivalsCmd.Flags().BoolVar(&groupStation, "group-by-station", false, "Show a separate table for each station, ordered by name")
+	arrivalsCmd.Flags().StringVar(&groupSort, "group-sort", "name", "Order stations in --group-by-station and --compact by name or by next arrival (name|next)")
+	arrivalsCmd.Flags().BoolVar(&compactBoard, "compact", false, "Show one line per station with the minutes until the next few trains of each route")
+	arrivalsCmd.Flags().BoolVar(&splitDirection, "split-direction", false, "Show a row per route with northbound and southbound trains side by side")
+	arrivalsCmd.Flags().BoolVar(&boardMode, "board", false, "Show a station board like the countdown clocks: both directions, route bullets, destinations, and minutes away")
+	arrivalsCmd.MarkFlagsMutuallyExclusive("group-by-station", "per-route", "compact", "split-direction", "board")
+	arrivalsCmd.Flags().BoolVar(&reversePath, "reverse", false, "With a single route and no station, list the stops from the other terminal")
+	arrivalsCmd.Flags().BoolVar(&showLegend, "legend", false, "List the routes shown under the table, with their colors and service names")
+	arrivalsCmd.Flags().BoolVar(&showLinks, "links", false, "Link station names to OpenStreetMap (terminals with OSC 8 hyperlink support only)")
+	arrivalsCmd.Flags().StringSliceVar(&columnsFlag, "columns", nil, "Table columns in order, from: stop_id, route, station, arrival, minutes, direction, destination, delay, vs_schedule, trip, track, stops_away")
+	arrivalsCmd.Flags().BoolVar(&showTrip, "show-trip", false, "Add a TRIP column with the trip ID and scheduled start time")
+	arrivalsCmd.Flags().DurationVar(&staleAfter, "stale-after", 5*time.Minute, "Dim predictions the feed last updated longer ago than this (0 disables)")
+	arrivalsCmd.Flags().StringSliceVar(&preferRoutes, "prefer-route", nil, "Highlight these routes and list them first among trains arriving in the same minute, without hiding others")
+	arrivalsCmd.Flags().StringVar(&terminatingAt, "terminating-at", "", "Show only trains whose trip ends at this station (name or stop ID)")
+	arrivalsCmd.Flags().BoolVar(&byTrip, "by-trip", false, "Show each train once, at the next of its stops that matches the filters")
+	arrivalsCmd.Flags().StringVar(&tripFilter, "trip", "", "Follow one train: show the remaining stops of this trip ID (or NYCT train ID) in order")
+	arrivalsCmd.Flags().IntVar(&nameWidth, "name-width", 0, "Abbreviate station and destination names to at most N characters (0 disables)")
+	arrivalsCmd.Flags().BoolVar(&showTrack, "show-track", false, "Add a TRACK column with the assigned track, where the feed reports one")
+	arrivalsCmd.Flags().BoolVar(&noHeader, "no-header", false, "Print only the table rows, without the header and the Total line")
+	arrivalsCmd.MarkFlagsMutuallyExclusive("no-header", "group-by-station", "per-route", "compact", "split-direction", "board")
+	arrivalsCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Write the output to a file instead of stdout")
+	arrivalsCmd.Flags().BoolVar(&appendOutput, "append", false, "With --output, append to the file instead of truncating it")
+	arrivalsCmd.Flags().DurationVar(&dedupeWindow, "dedupe-window", 0, "Merge predictions for the same stop and route within this window (0 disables)")
+	arrivalsCmd.Flags().StringVar(&eventMode, "mode", "at", "Show when trains arrive at the station or depart from it (at|from)")
+	arrivalsCmd.Flags().StringVar(&dedupeKeep, "dedupe-keep", "earlier", "Which prediction --dedupe-window keeps: earlier or later")
+	arrivalsCmd.Flags().BoolVar(&withSchedule, "with-schedule", false, "Also show the next hour of scheduled arrivals from the static GTFS schedule")
+	arrivalsCmd.Flags().BoolVar(&vsSchedule, "vs-schedule", false, "Add a VS_SCHEDULE column comparing each prediction with the trip's time in the static GTFS schedule")
+	arrivalsCmd.Flags().BoolVar(&bothDirections, "both-directions", false, "With a directional stop, also show the opposite direction, e.g. 116S for 116N")
+	arrivalsCmd.Flags().StringSliceVar(&onlyStops, "only-stops", nil, "Show only these stop IDs, e.g. 116N,110N (parent IDs include both directions)")
+	arrivalsCmd.Flags().StringSliceVar(&excludeStops, "exclude-stops", nil, "Hide these stop IDs, e.g. 116N,110N (parent IDs include both directions)")
+	arrivalsCmd.Flags().DurationVar(&minHeadway, "min-headway", 0, "Warn about gaps longer than this between consecutive trains of a route at a stop, e.g. 12m")
+	arrivalsCmd.Flags().IntVar(&minMinutes, "min-minutes", 0, "Skip arrivals sooner than N minutes from now")
+	arrivalsCmd.Flags().DurationVar(&secondsBelow, "seconds-threshold", 2*time.Minute, "Show the time until trains closer than this in seconds (0 for whole minutes only)")
+	arrivalsCmd.Flags().BoolVar(&use24Hour, "24h", false, "Show clock times in 24-hour format, e.g. 17:08")
+	arrivalsCmd.Flags().StringVar(&timeFormat, "time-format", "", "Go layout for clock times, e.g. 15:04 or 3:04pm (overrides the 12-hour default)")
+	arrivalsCmd.Flags().StringVar(&nowFlag, "now", "", "Treat this RFC 3339 instant as the current time, e.g. 2024-05-01T08:30:00-04:00 (for replaying feeds and reproducible output)")
 }
@@ -0,0 +1,543 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterArrivals(t *testing.T) {
+	arrivals := parseArrivals(loadFeedFixture(t, "gtfs.pb"), nil, fixtureTime, false)
+	index := testIndex(t)
+
+	tests := []struct {
+		name    string
+		station string
+		routes  []string
+		both    bool
+		want    []string // route/stop pairs, in feed order
+		wantErr bool
+	}{
+		{name: "stop ID", station: "116N", want: []string{"1/116N"}},
+		{name: "both directions", station: "116N", both: true, want: []string{"1/116N", "1/116S", "1/116S"}},
+		{name: "parent stop ID", station: "116", want: []string{"1/116N", "1/116S", "1/116S"}},
+		{name: "station name", station: "116 St-Columbia University", want: []string{"1/117N", "1/117S"}},
+		{name: "route only", routes: []string{"2"}, want: []string{"2/120S", "2/127S"}},
+		{name: "station and route", station: "120S", routes: []string{"2"}, want: []string{"2/120S"}},
+		{name: "shared name narrowed by route", station: "96 St", routes: []string{"6"}, want: []string{"6/625N"}},
+		{name: "shared name", station: "96 St", wantErr: true},
+		{name: "unknown station", station: "Nowhere", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := filterArrivals(arrivals, tt.station, tt.routes, index, tt.both)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error, want one; got %d arrivals", len(filtered))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, arrival := range filtered {
+				got = append(got, arrival.RouteID+"/"+arrival.StopID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("arrivals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The candidates of a shared name list the routes seen at each
+	_, err := filterArrivals(arrivals, "96 St", nil, index, false)
+	var dup *DuplicateStationError
+	if !errors.As(err, &dup) {
+		t.Fatalf("error = %v, want a *DuplicateStationError", err)
+	}
+	for _, candidate := range dup.Candidates {
+		want := map[string][]string{"120": {"1", "2"}, "625": {"6"}}[candidate.StopID]
+		if !slices.Equal(candidate.Routes, want) {
+			t.Errorf("routes at %s = %v, want %v", candidate.StopID, candidate.Routes, want)
+		}
+	}
+}
+
+func TestDisplayArrivals(t *testing.T) {
+	columns, err := selectColumns(defaultColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &tableColumns, columns)
+	setGlobal(t, &asOf, fixtureTime)
+	setGlobal(t, &colorOutput, false)
+
+	stopIDToName, _, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrivals := parseArrivals(loadFeedFixture(t, "gtfs.pb"), nil, fixtureTime, false)
+
+	var out bytes.Buffer
+	displayArrivals(&out, arrivals, stopIDToName)
+	checkGolden(t, "arrivals.golden", out.Bytes())
+}
+
+func TestArrivalsUsageErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		// json reports the error as {"error": ...} on stderr
+		json bool
+	}{
+		{args: []string{"--mode", "bogus"}},
+		{args: []string{"--repeat", "0"}},
+		{args: []string{"--per-route", "-1"}},
+		{args: []string{"--columns", "foo"}},
+		{args: []string{"--stream"}},
+		{args: []string{"--json", "--repeat", "0"}, json: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, stdout, stderr := runArrivals(t, tt.args...)
+			if code != exitError {
+				t.Errorf("exit status = %d, want %d", code, exitError)
+			}
+			output := stdout + stderr
+			if tt.json {
+				output = stderr
+			}
+			if !strings.Contains(output, "rror") {
+				t.Errorf("no error reported; stdout %q, stderr %q", stdout, stderr)
+			}
+		})
+	}
+}
+
+func TestArrivalsUnknownRoute(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeedServer(t, server)
+
+	code, _, stderr := runArrivals(t, "--routes", "1,9", "--stops-file", "testdata/stops.csv")
+	if code != exitError {
+		t.Errorf("exit status = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stderr, "unknown route: 9") {
+		t.Errorf("stderr = %q, want the unknown route", stderr)
+	}
+	if n := server.requests.Load(); n != 0 {
+		t.Errorf("%d feed requests, want none before the routes are validated", n)
+	}
+}
+
+func TestDedupeArrivals(t *testing.T) {
+	base := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+
+	// Two feed updates in one message predict the same trains a few
+	// seconds apart
+	arrivals := []Arrival{
+		{StopID: "116S", RouteID: "1", TripID: "a", Arrival: at(60)},
+		{StopID: "120S", RouteID: "2", TripID: "b", Arrival: at(300)},
+		{StopID: "116S", RouteID: "1", TripID: "a", Arrival: at(75)},
+		{StopID: "116S", RouteID: "1", TripID: "c", Arrival: at(600)},
+		{StopID: "120S", RouteID: "2", TripID: "b", Arrival: at(290)},
+		{StopID: "120S", RouteID: "3", TripID: "d", Arrival: at(295)},
+		{StopID: "116N", RouteID: "1", TripID: "e", Arrival: at(60)},
+	}
+
+	tests := []struct {
+		name      string
+		window    time.Duration
+		keepLater bool
+		want      []string // stop/route/seconds, sorted by stop, route, and time
+	}{
+		{
+			name:   "off",
+			window: 0,
+			want:   []string{"116S/1/60", "120S/2/300", "116S/1/75", "116S/1/600", "120S/2/290", "120S/3/295", "116N/1/60"},
+		},
+		{
+			name:   "keep earlier",
+			window: 30 * time.Second,
+			want:   []string{"116N/1/60", "116S/1/60", "116S/1/600", "120S/2/290", "120S/3/295"},
+		},
+		{
+			name:      "keep later",
+			window:    30 * time.Second,
+			keepLater: true,
+			want:      []string{"116N/1/60", "116S/1/75", "116S/1/600", "120S/2/300", "120S/3/295"},
+		},
+		{
+			name:   "window shorter than the gaps",
+			window: 5 * time.Second,
+			want:   []string{"116N/1/60", "116S/1/60", "116S/1/75", "116S/1/600", "120S/2/290", "120S/2/300", "120S/3/295"},
+		},
+		{
+			name:   "window equal to a gap",
+			window: 10 * time.Second,
+			want:   []string{"116N/1/60", "116S/1/60", "116S/1/75", "116S/1/600", "120S/2/290", "120S/3/295"},
+		},
+		{
+			// Runs are measured from their first arrival, so a long window
+			// still keeps trains far enough apart
+			name:   "runs measured from the first arrival",
+			window: 9 * time.Minute,
+			want:   []string{"116N/1/60", "116S/1/60", "120S/2/290", "120S/3/295"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, arrival := range dedupeArrivals(slices.Clone(arrivals), tt.window, tt.keepLater) {
+				seconds := int(arrival.Arrival.Sub(base) / time.Second)
+				got = append(got, arrival.StopID+"/"+arrival.RouteID+"/"+strconv.Itoa(seconds))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("arrivals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterStops(t *testing.T) {
+	index := StopIndex{
+		StopIDToName: map[string]string{"116": "125 St", "116N": "125 St", "116S": "125 St", "117N": "116 St-Columbia University"},
+		Children:     map[string][]string{"116": {"116N", "116S"}},
+	}
+	arrivals := []Arrival{
+		{StopID: "116N", RouteID: "1"},
+		{StopID: "116S", RouteID: "1"},
+		{StopID: "117N", RouteID: "1"},
+		{StopID: "120S", RouteID: "2"},
+	}
+
+	tests := []struct {
+		name          string
+		only, exclude []string
+		want          []string
+	}{
+		{name: "only", only: []string{"116N", "120S"}, want: []string{"116N", "120S"}},
+		{name: "only parent", only: []string{"116"}, want: []string{"116N", "116S"}},
+		{name: "exclude", exclude: []string{"117N"}, want: []string{"116N", "116S", "120S"}},
+		{name: "exclude parent", exclude: []string{"116"}, want: []string{"117N", "120S"}},
+		{name: "only and exclude", only: []string{"116"}, exclude: []string{"116S"}, want: []string{"116N"}},
+		{name: "only unknown", only: []string{"999N"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, arrival := range filterStops(arrivals, expandStopIDs(tt.only, index), expandStopIDs(tt.exclude, index)) {
+				got = append(got, arrival.StopID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarnUnseenStops(t *testing.T) {
+	index := StopIndex{StopIDToName: map[string]string{"116N": "125 St"}}
+	arrivals := []Arrival{{StopID: "R16N", RouteID: "N"}}
+
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stderr
+	os.Stderr = stderr
+	warnUnseenStops([]string{"116N", "R16N", "11GN"}, arrivals, index)
+	os.Stderr = saved
+
+	// Stops in the stop data or the feed are fine; only the typo is reported
+	out, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "Warning: stop 11GN does not appear in the stop data or the feed"; got != want {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+}
+
+func TestWatchDuration(t *testing.T) {
+	now := time.Now()
+	message := feedMessage(t, now, stopUpdate{tripID: "098200_1..S03R", routeID: "1", stopID: "116S", arrival: now.Add(5 * time.Minute)})
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(message)
+	})
+	useFeeds(t, []Feed{{Name: "test", URL: server.URL, Routes: []string{"1"}}})
+
+	// The interval is far longer than the test, so only the duration ends it
+	start := time.Now()
+	_, stdout, _ := runArrivals(t, "116S", "--watch", "--interval=1h", "--watch-duration=100ms")
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("watch ran for %s, want about 100ms", elapsed)
+	}
+	if !strings.Contains(stdout, "116S") {
+		t.Errorf("output has no board:\n%s", stdout)
+	}
+	if want := "Watch stopped after 100ms: 1 refreshes, 1 arrivals in the last one."; !strings.Contains(stdout, want) {
+		t.Errorf("output has no summary %q:\n%s", want, stdout)
+	}
+}
+
+func TestRateLimitBackoff(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		n          int // consecutive rate limits
+		want       time.Duration
+	}{
+		{retryAfter: 20 * time.Second, n: 1, want: 20 * time.Second},
+		{retryAfter: 20 * time.Second, n: 5, want: 20 * time.Second},
+		{n: 1, want: time.Minute},
+		{n: 2, want: 2 * time.Minute},
+		{n: 3, want: 4 * time.Minute},
+		{n: 5, want: maxRateLimitBackoff},
+		{n: 50, want: maxRateLimitBackoff},
+	}
+	for _, tt := range tests {
+		got := rateLimitBackoff(&RateLimitError{RetryAfter: tt.retryAfter}, 30*time.Second, tt.n)
+		if got != tt.want {
+			t.Errorf("rateLimitBackoff(Retry-After %s, rate limit %d) = %s, want %s", tt.retryAfter, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWatchRateLimitPause(t *testing.T) {
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	useFeeds(t, []Feed{{Name: "test", URL: server.URL, Routes: []string{"1"}}})
+
+	// Without the pause, the short interval would fetch several times
+	// before the watch ends
+	_, _, stderr := runArrivals(t, "116S", "--watch", "--stream", "--interval=50ms", "--watch-duration=500ms")
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+	if !strings.Contains(stderr, "Rate limited; pausing until") {
+		t.Errorf("no pause notice on stderr:\n%s", stderr)
+	}
+}
+
+func TestArrivalsBothDirections(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeeds(t, []Feed{{Name: "1234567S", URL: server.URL, Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}}})
+	now := "--now=" + fixtureTime.Format(time.RFC3339)
+
+	// rows returns the stop IDs of the table rows, in order
+	rows := func(stdout string) []string {
+		var stops []string
+		for _, line := range strings.Split(stdout, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], "116") {
+				stops = append(stops, fields[0])
+			}
+		}
+		return stops
+	}
+
+	_, stdout, _ := runArrivals(t, "116N", now)
+	if got, want := rows(stdout), []string{"116N"}; !slices.Equal(got, want) {
+		t.Errorf("without --both-directions, rows = %v, want %v", got, want)
+	}
+	_, stdout, _ = runArrivals(t, "116N", "--both-directions", now)
+	if got, want := rows(stdout), []string{"116S", "116N", "116S"}; !slices.Equal(got, want) {
+		t.Errorf("with --both-directions, rows = %v, want %v", got, want)
+	}
+}
+
+func TestArrivalsJSONWarnings(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeedServer(t, server)
+	now := fixtureTime.Format(time.RFC3339)
+
+	// Stops data without the schedule files next to it
+	stops := filepath.Join(t.TempDir(), "stops.csv")
+	if err := os.WriteFile(stops, readFixture(t, "stops.csv"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [][]string{
+		{"--json", "--now", now, "--routes", "1", "--stops-file", "/nonexistent"},
+		{"--json", "--now", now, "--routes", "1", "--stops-file", stops, "--with-schedule", "116S"},
+	}
+	for _, args := range tests {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			_, stdout, stderr := runArrivals(t, args...)
+			var document []map[string]any
+			if err := json.Unmarshal([]byte(stdout), &document); err != nil || len(document) == 0 {
+				t.Errorf("stdout is not a JSON document of arrivals: %v\n%s", err, stdout)
+			}
+			if !strings.Contains(stderr, "Warning") {
+				t.Errorf("stderr = %q, want the warning", stderr)
+			}
+		})
+	}
+}
+
+func TestPrintArrivalRowStale(t *testing.T) {
+	columns, err := selectColumns(defaultColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &tableColumns, columns)
+	setGlobal(t, &asOf, fixtureTime)
+	setGlobal(t, &colorOutput, true)
+	setGlobal(t, &staleAfter, time.Minute)
+	setGlobal(t, &preferredRoutes, routeSet([]string{"1"}))
+
+	arrival := Arrival{StopID: "116S", RouteID: "1", Arrival: fixtureTime.Add(5 * time.Minute), Updated: fixtureTime.Add(-10 * time.Minute)}
+	var out bytes.Buffer
+	printArrivalRow(&out, arrival, nil, "")
+	row := out.String()
+
+	// The route badge ends with a reset; dim and bold carry on after it
+	if !strings.Contains(row, "\033[0m") {
+		t.Fatalf("row has no route color: %q", row)
+	}
+	for _, part := range strings.Split(row, "\033[0m")[1:] {
+		if !strings.HasPrefix(part, "\033[1m\033[2m") {
+			t.Errorf("styles not applied again after a reset: %q", row)
+			break
+		}
+	}
+}
+
+func TestFormatMinutesAway(t *testing.T) {
+	now := fixtureTime
+	tests := []struct {
+		away      time.Duration
+		threshold time.Duration
+		want      string
+	}{
+		{away: -10 * time.Second, threshold: 2 * time.Minute, want: "now"},
+		{away: 500 * time.Millisecond, threshold: 2 * time.Minute, want: "now"},
+		{away: time.Second, threshold: 2 * time.Minute, want: "1s"},
+		{away: 45 * time.Second, threshold: 2 * time.Minute, want: "45s"},
+		{away: 59 * time.Second, threshold: 2 * time.Minute, want: "59s"},
+		{away: time.Minute, threshold: 2 * time.Minute, want: "1m 00s"},
+		{away: 65 * time.Second, threshold: 2 * time.Minute, want: "1m 05s"},
+		{away: 2*time.Minute - time.Second, threshold: 2 * time.Minute, want: "1m 59s"},
+		{away: 2 * time.Minute, threshold: 2 * time.Minute, want: "2 min"},
+		{away: 2*time.Minute + 59*time.Second, threshold: 2 * time.Minute, want: "2 min"},
+		{away: 45 * time.Second, threshold: 30 * time.Second, want: "now"},
+		{away: 90 * time.Second, threshold: 30 * time.Second, want: "1 min"},
+		{away: 45 * time.Second, threshold: 0, want: "now"},
+		{away: 10 * time.Minute, threshold: 0, want: "10 min"},
+	}
+	for _, tt := range tests {
+		setGlobal(t, &secondsBelow, tt.threshold)
+		if got := formatMinutesAway(now.Add(tt.away), now); got != tt.want {
+			t.Errorf("formatMinutesAway(%s) with threshold %s = %q, want %q", tt.away, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestFirstPerTrip(t *testing.T) {
+	arrivals := parseArrivals(loadFeedFixture(t, "gtfs.pb"), routeSet([]string{"1"}), fixtureTime, false)
+	index := testIndex(t)
+
+	// Trip 097550_1..N03R has updates for 120N, 117N, 116N, and 101N
+	tests := []struct {
+		station string
+		want    []string // trip/stop pairs, soonest first
+	}{
+		{station: "", want: []string{"098200_1..S03R/116S", "097550_1..N03R/120N", "099000_1..S03R/101S"}},
+		{station: "120N", want: []string{"097550_1..N03R/120N"}},
+		{station: "116", want: []string{"098200_1..S03R/116S", "097550_1..N03R/116N", "099000_1..S03R/116S"}},
+	}
+	for _, tt := range tests {
+		filtered, err := filterArrivals(slices.Clone(arrivals), tt.station, nil, index, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, arrival := range firstPerTrip(filtered) {
+			got = append(got, arrival.TripID+"/"+arrival.StopID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("station %q: trains = %v, want %v", tt.station, got, tt.want)
+		}
+	}
+}
+
+func TestSortArrivalsTies(t *testing.T) {
+	// All due at the same time, so only the tiebreaks decide the order
+	at := fixtureTime.Add(5 * time.Minute)
+	want := []Arrival{
+		{RouteID: "1", TripID: "097550_1..N03R", StopID: "116N", Arrival: at},
+		{RouteID: "1", TripID: "098200_1..S03R", StopID: "116S", Arrival: at},
+		{RouteID: "1", TripID: "099000_1..S03R", StopID: "116S", Arrival: at},
+		{RouteID: "2", TripID: "097600_2..N08R", StopID: "116N", Arrival: at},
+		{RouteID: "2", TripID: "097600_2..N08R", StopID: "117N", Arrival: at},
+		{RouteID: "2", TripID: "098100_2..S08R", StopID: "116S", Arrival: at},
+	}
+
+	for shift := range want {
+		for _, reverse := range []bool{false, true} {
+			arrivals := append(slices.Clone(want[shift:]), want[:shift]...)
+			if reverse {
+				slices.Reverse(arrivals)
+			}
+			sortArrivals(arrivals)
+			if !slices.Equal(arrivals, want) {
+				t.Errorf("shift %d, reverse %v: got %v, want %v", shift, reverse, arrivals, want)
+			}
+		}
+	}
+}
+
+func TestArrivalsRepeatCanceled(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeedServer(t, server)
+
+	// The interval is far longer than the test, so only canceling ends
+	// the pause after the first run
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	arrivalsCmd.SetContext(ctx)
+	t.Cleanup(func() { arrivalsCmd.SetContext(context.Background()) })
+
+	start := time.Now()
+	code, stdout, _ := runArrivals(t, "116N", "--routes=1", "--repeat=3", "--interval=1h", "--count", "--now="+fixtureTime.Format(time.RFC3339))
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("repeat ran for %s after the context was canceled", elapsed)
+	}
+	if code != exitOK {
+		t.Errorf("exit status = %d, want %d", code, exitOK)
+	}
+	if got := strings.Fields(stdout); len(got) != 1 || server.requests.Load() != 1 {
+		t.Errorf("output %q after %d requests, want a single run", stdout, server.requests.Load())
+	}
+}
+
+func TestArrivalsKeepsFlags(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeedServer(t, server)
+	now := "--now=" + fixtureTime.Format(time.RFC3339)
+
+	// The flags read back as given once the run is over
+	if code, _, stderr := runArrivals(t, "116N", "--routes=reds", "--json-meta", "--prefer-route=1", now); code != exitOK {
+		t.Fatalf("exit status = %d, want %d\n%s", code, exitOK, stderr)
+	}
+	if jsonOutput || !slices.Equal(routes, []string{"reds"}) {
+		t.Errorf("after the run, --json = %v and --routes = %v, want false and [reds]", jsonOutput, routes)
+	}
+
+	// A later run without --prefer-route prefers no route
+	runArrivals(t, "116N", "--routes=1", "--count", now)
+	if len(preferredRoutes) != 0 {
+		t.Errorf("preferred routes = %v after a run without --prefer-route", preferredRoutes)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// boardPerDirection is how many trains --board lists per direction, as
+// many as the countdown clocks on the platforms show
+const boardPerDirection = 4
+
+// boardHeading names a direction of a station board. Routes that agree on
+// the sign wording use it, e.g. "Downtown & Brooklyn"; otherwise the
+// compass direction is used.
+func boardHeading(direction string, arrivals []Arrival) string {
+	heading := ""
+	for _, arrival := range arrivals {
+		label := directionLabel(arrival.RouteID, direction)
+		if heading != "" && label != heading {
+			heading = ""
+			break
+		}
+		heading = label
+	}
+	if heading == "" || heading == direction {
+		if name := directionName(direction); name != "" {
+			return strings.ToUpper(name[:1]) + name[1:]
+		}
+		return "Other"
+	}
+	return heading
+}
+
+// displayBoard writes a board per station to w in the style of the
+// countdown clocks: the next few trains in each direction, each with a
+// route bullet, its destination, and the time until it arrives.
+// Without color the bullets are plain route IDs.
+func displayBoard(w io.Writer, groups []StationGroup, stopIDToName map[string]string, now time.Time) {
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, colorize(group.Station, "1"))
+
+		// Bucket by the direction suffix of the stop ID, northbound first
+		byDirection := make(map[string][]Arrival)
+		for _, arrival := range group.Arrivals {
+			direction := stopDirection(arrival.StopID)
+			byDirection[direction] = append(byDirection[direction], arrival)
+		}
+		for _, direction := range []string{"N", "S", ""} {
+			arrivals := byDirection[direction]
+			if len(arrivals) == 0 {
+				continue
+			}
+			sortArrivals(arrivals)
+			if len(arrivals) > boardPerDirection {
+				arrivals = arrivals[:boardPerDirection]
+			}
+
+			destinations := make([]string, len(arrivals))
+			width := 0
+			for j, arrival := range arrivals {
+				destinations[j] = "-"
+				if arrival.Destination != "" {
+					destinations[j], _ = lookupStationName(arrival.Destination, stopIDToName)
+				}
+				width = max(width, utf8.RuneCountInString(destinations[j]))
+			}
+
+			fmt.Fprintf(w, "\n  %s\n", boardHeading(direction, arrivals))
+			for j, arrival := range arrivals {
+				// Pad one-letter bullets to line up with SI and GS
+				bullet := routeBadge(arrival.RouteID) + strings.Repeat(" ", max(2-len(arrival.RouteID), 0))
+				fmt.Fprintf(w, "  %s %s  %7s\n", bullet, padRight(destinations[j], width), formatMinutesAway(arrival.Arrival, now))
+			}
+		}
+	}
+}
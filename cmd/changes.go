@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Change markers shown next to arrivals in watch mode
+const (
+	markNew     = "*"
+	markEarlier = "↑"
+	markLater   = "↓"
+	// markDeparted flags departed trains when styling is disabled
+	markDeparted = "x"
+)
+
+// ArrivalChanges describes how a batch of arrivals differs from the previous one
+type ArrivalChanges struct {
+	// Marks maps an arrival key to its change marker
+	Marks map[string]string
+	// Departed holds arrivals from the previous batch that are no longer predicted
+	Departed []Arrival
+}
+
+// arrivalKey identifies the same predicted arrival across refreshes
+func arrivalKey(arrival Arrival) string {
+	return arrival.TripID + "|" + arrival.StopID
+}
+
+// diffArrivals compares the current batch of arrivals against the previous one,
+// marking new arrivals and arrivals whose predicted time moved by more than threshold
+func diffArrivals(previous, current []Arrival, threshold time.Duration) ArrivalChanges {
+	changes := ArrivalChanges{Marks: make(map[string]string)}
+
+	before := make(map[string]Arrival, len(previous))
+	for _, arrival := range previous {
+		before[arrivalKey(arrival)] = arrival
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, arrival := range current {
+		key := arrivalKey(arrival)
+		seen[key] = true
+
+		old, ok := before[key]
+		if !ok {
+			changes.Marks[key] = markNew
+			continue
+		}
+
+		shift := arrival.Arrival.Sub(old.Arrival)
+		if shift > threshold {
+			changes.Marks[key] = markLater
+		} else if shift < -threshold {
+			changes.Marks[key] = markEarlier
+		}
+	}
+
+	for _, arrival := range previous {
+		if !seen[arrivalKey(arrival)] {
+			changes.Departed = append(changes.Departed, arrival)
+		}
+	}
+	sortArrivals(changes.Departed)
+
+	return changes
+}
+
+// displayChangedArrivals writes the arrivals to w as a formatted table with
+// change markers, followed by the departed arrivals struck through
+func displayChangedArrivals(w io.Writer, arrivals []Arrival, stopIDToName map[string]string, changes ArrivalChanges) {
+	// Sort by arrival time, preferred routes first within a minute
+	sortArrivals(arrivals)
+	sortPreferred(arrivals)
+
+	printArrivalHeader(w)
+	for _, arrival := range arrivals {
+		printArrivalRow(w, arrival, stopIDToName, changes.Marks[arrivalKey(arrival)])
+	}
+	for _, arrival := range changes.Departed {
+		if !colorOutput {
+			printArrivalRow(w, arrival, stopIDToName, markDeparted)
+			continue
+		}
+		fmt.Fprint(w, "\033[9m") // ANSI strikethrough
+		printArrivalRow(w, arrival, stopIDToName, "")
+		fmt.Fprint(w, "\033[0m")
+	}
+	fmt.Fprintf(w, "\nTotal: %d upcoming arrivals\n", len(arrivals))
+	if colorOutput {
+		fmt.Fprintf(w, "%s new  %s earlier  %s later  departed trains are struck through\n", markNew, markEarlier, markLater)
+	} else {
+		fmt.Fprintf(w, "%s new  %s earlier  %s later  %s departed\n", markNew, markEarlier, markLater, markDeparted)
+	}
+	printUnknownStopsNote(w, unknownStopIDs(arrivals, stopIDToName))
+}
+
+// tailMemory is how long tail mode remembers an arrival after its predicted
+// time, so that a prediction dropping out of the feed for a refresh or two
+// isn't reported as new when it comes back
+const tailMemory = time.Hour
+
+// newArrivals returns the arrivals whose trip and stop aren't in seen,
+// ordered by time, and adds them to seen, which maps arrival keys to
+// predicted times. Arrivals predicted more than tailMemory before now are
+// forgotten.
+func newArrivals(seen map[string]time.Time, arrivals []Arrival, now time.Time) []Arrival {
+	for key, predicted := range seen {
+		if now.Sub(predicted) > tailMemory {
+			delete(seen, key)
+		}
+	}
+
+	var fresh []Arrival
+	for _, arrival := range arrivals {
+		key := arrivalKey(arrival)
+		if _, ok := seen[key]; !ok {
+			fresh = append(fresh, arrival)
+		}
+		seen[key] = arrival.Arrival
+	}
+	sortArrivals(fresh)
+	return fresh
+}
+
+// tailSeenWidth returns the width of the SEEN column of tail mode: the
+// longest time the clock layout prints, e.g. "11:59:59 PM", and a space
+func tailSeenWidth() int {
+	longest := time.Date(2026, time.September, 30, 23, 59, 59, 0, time.Local)
+	return max(len("SEEN"), utf8.RuneCountInString(formatClockSeconds(longest))) + 1
+}
+
+// printTailLines writes a table row for each arrival, prefixed with the
+// time it was first seen, and the header row first if header is set
+func printTailLines(w io.Writer, arrivals []Arrival, stopIDToName map[string]string, seenAt time.Time, header bool) {
+	width := tailSeenWidth()
+	if header {
+		fmt.Fprint(w, padRight("SEEN", width))
+		writeTableRow(w, tableColumns, func(col column) (string, string) {
+			return col.Header, col.Header
+		})
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, strings.Repeat("-", width+tableRuleWidth))
+	}
+	for _, arrival := range arrivals {
+		fmt.Fprint(w, padRight(formatClockSeconds(seenAt), width))
+		printArrivalRow(w, arrival, stopIDToName, "")
+	}
+}
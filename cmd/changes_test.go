@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintTailLines(t *testing.T) {
+	columns, err := selectColumns(defaultColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &tableColumns, columns)
+	setGlobal(t, &asOf, fixtureTime)
+	setGlobal(t, &colorOutput, false)
+	stopIDToName, _, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second fetch of the feed adds a trip stopping at 116S and 117S
+	routes := routeSet([]string{"1"})
+	seen := make(map[string]time.Time)
+	var first, second bytes.Buffer
+	printTailLines(&first, newArrivals(seen, parseArrivals(loadFeedFixture(t, "gtfs.pb"), routes, fixtureTime, false), fixtureTime), stopIDToName, fixtureTime, true)
+	later := fixtureTime.Add(30 * time.Second).Local()
+	printTailLines(&second, newArrivals(seen, parseArrivals(loadFeedFixture(t, "gtfs_next.pb"), routes, later, false), later), stopIDToName, later, false)
+
+	lines := strings.Split(strings.TrimSuffix(first.String(), "\n"), "\n")
+	if got := len(lines) - 2; got != 9 {
+		t.Errorf("first fetch printed %d arrivals, want 9", got)
+	}
+	want := "3:00:30 PM  116S       1        125 St                              12 min  3:12 PM\n" +
+		"3:00:30 PM  117S       1        116 St-Columbia University          14 min  3:14 PM\n"
+	if second.String() != want {
+		t.Errorf("second fetch printed:\n%s\nwant only the new trip:\n%s", second.String(), want)
+	}
+
+	// The header, the rule under it, and the rows share the SEEN width
+	for _, layout := range []bool{false, true} {
+		setClockLayout(layout, "")
+		t.Cleanup(func() { setClockLayout(false, "") })
+
+		var out bytes.Buffer
+		printTailLines(&out, parseArrivals(loadFeedFixture(t, "gtfs.pb"), routes, fixtureTime, false)[:1], stopIDToName, fixtureTime, true)
+		lines := strings.Split(out.String(), "\n")
+		header, rule, row := lines[0], lines[1], lines[2]
+		column := strings.Index(header, "STOP_ID")
+		if got := strings.Index(row, "120N"); got != column {
+			t.Errorf("24h=%v: row starts its first column at %d, header at %d:\n%s", layout, got, column, out.String())
+		}
+		if len(rule) != column+tableRuleWidth {
+			t.Errorf("24h=%v: rule is %d wide, want %d", layout, len(rule), column+tableRuleWidth)
+		}
+	}
+}
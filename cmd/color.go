@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Values accepted by --color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var (
+	colorMode string
+	noColor   bool
+	// colorOutput is set by commands that style their output, from useColor
+	colorOutput bool
+)
+
+// routeColors are the official MTA route colors, as RGB
+var routeColors = map[string][3]int{
+	"1": {0xEE, 0x35, 0x2E}, "2": {0xEE, 0x35, 0x2E}, "3": {0xEE, 0x35, 0x2E},
+	"4": {0x00, 0x93, 0x3C}, "5": {0x00, 0x93, 0x3C}, "6": {0x00, 0x93, 0x3C},
+	"7": {0xB9, 0x33, 0xAD},
+	"A": {0x00, 0x39, 0xA6}, "C": {0x00, 0x39, 0xA6}, "E": {0x00, 0x39, 0xA6},
+	"B": {0xFF, 0x63, 0x19}, "D": {0xFF, 0x63, 0x19}, "F": {0xFF, 0x63, 0x19}, "M": {0xFF, 0x63, 0x19},
+	"G": {0x6C, 0xBE, 0x45},
+	"J": {0x99, 0x66, 0x33}, "Z": {0x99, 0x66, 0x33},
+	"L": {0xA7, 0xA9, 0xAC},
+	"N": {0xFC, 0xCC, 0x0A}, "Q": {0xFC, 0xCC, 0x0A}, "R": {0xFC, 0xCC, 0x0A}, "W": {0xFC, 0xCC, 0x0A},
+	"GS": {0x80, 0x81, 0x83}, "FS": {0x80, 0x81, 0x83}, "H": {0x80, 0x81, 0x83},
+	"SI": {0x00, 0x39, 0xA6},
+}
+
+// routeNames are the MTA service names of the routes, shown by --legend
+var routeNames = map[string]string{
+	"1": "Broadway-7 Av Local", "2": "7 Av Express", "3": "7 Av Express",
+	"4": "Lexington Av Express", "5": "Lexington Av Express", "6": "Lexington Av Local",
+	"7": "Flushing Local",
+	"A": "8 Av Express", "C": "8 Av Local", "E": "8 Av Local",
+	"B": "6 Av Express", "D": "6 Av Express", "F": "6 Av Local", "M": "6 Av Local",
+	"G": "Brooklyn-Queens Crosstown",
+	"J": "Nassau St Local", "Z": "Nassau St Express",
+	"L": "14 St-Canarsie Local",
+	"N": "Broadway Express", "Q": "Broadway Express", "R": "Broadway Local", "W": "Broadway Local",
+	"GS": "42 St Shuttle", "FS": "Franklin Av Shuttle", "H": "Rockaway Park Shuttle",
+	"SI": "Staten Island Railway",
+}
+
+// validateColorMode checks the value of --color
+func validateColorMode(mode string) error {
+	switch mode {
+	case colorAuto, colorAlways, colorNever:
+		return nil
+	default:
+		return fmt.Errorf("invalid --color value %q: must be auto, always, or never", mode)
+	}
+}
+
+// colorEnabled decides whether output should be styled. --color=always
+// forces color; otherwise --color=never, --no-color, a non-empty NO_COLOR
+// environment variable, or a non-terminal output each disable it.
+func colorEnabled(mode string, noColorFlag, noColorEnv, tty bool) bool {
+	if mode == colorAlways {
+		return true
+	}
+	return mode != colorNever && !noColorFlag && !noColorEnv && tty
+}
+
+// useColor reports whether output written to w should be styled.
+// Every colorized code path goes through this decision. On Windows it also
+// enables escape sequences in the console, and disables color where the
+// console can't show it.
+func useColor(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	tty := ok && isTerminal(f) && enableEscapes(f)
+	return colorEnabled(colorMode, noColor, os.Getenv("NO_COLOR") != "", tty)
+}
+
+// colorRoute renders a route ID in its route color when colorOutput is set
+func colorRoute(routeID string) string {
+	rgb, ok := routeColors[routeID]
+	if !colorOutput || !ok {
+		return routeID
+	}
+	return fmt.Sprintf("\033[1;38;2;%d;%d;%dm%s\033[0m", rgb[0], rgb[1], rgb[2], routeID)
+}
+
+// colorize wraps text in the given SGR color code, e.g. "32" for green,
+// when color output is enabled
+func colorize(text, code string) string {
+	if !colorOutput {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+// withStyle wraps text in the SGR attribute on, such as "2" for dim, ended
+// by off. The attribute is applied again after every reset in text, so route
+// colors and other styles inside it don't end it early.
+func withStyle(text, on, off string) string {
+	start := "\033[" + on + "m"
+	return start + strings.ReplaceAll(text, "\033[0m", "\033[0m"+start) + "\033[" + off + "m"
+}
+
+// routeBadge renders a route ID as a badge on its route color when
+// colorOutput is set, with dark text on the light yellow and gray routes
+func routeBadge(routeID string) string {
+	rgb, ok := routeColors[routeID]
+	if !colorOutput || !ok {
+		return " " + routeID + " "
+	}
+	foreground := 97
+	if 299*rgb[0]+587*rgb[1]+114*rgb[2] > 150000 {
+		foreground = 30
+	}
+	return fmt.Sprintf("\033[1;%d;48;2;%d;%d;%dm %s \033[0m", foreground, rgb[0], rgb[1], rgb[2], routeID)
+}
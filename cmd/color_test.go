@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		mode                 string
+		noColorFlag, noColor bool // --no-color, NO_COLOR
+		tty                  bool
+		want                 bool
+	}{
+		// --color=always forces color over everything else
+		{mode: colorAlways, tty: true, want: true},
+		{mode: colorAlways, tty: false, want: true},
+		{mode: colorAlways, noColorFlag: true, tty: true, want: true},
+		{mode: colorAlways, noColorFlag: true, tty: false, want: true},
+		{mode: colorAlways, noColor: true, tty: true, want: true},
+		{mode: colorAlways, noColor: true, tty: false, want: true},
+		{mode: colorAlways, noColorFlag: true, noColor: true, tty: true, want: true},
+		{mode: colorAlways, noColorFlag: true, noColor: true, tty: false, want: true},
+
+		// --color=auto colors a terminal unless --no-color or NO_COLOR
+		{mode: colorAuto, tty: true, want: true},
+		{mode: colorAuto, tty: false, want: false},
+		{mode: colorAuto, noColorFlag: true, tty: true, want: false},
+		{mode: colorAuto, noColorFlag: true, tty: false, want: false},
+		{mode: colorAuto, noColor: true, tty: true, want: false},
+		{mode: colorAuto, noColor: true, tty: false, want: false},
+		{mode: colorAuto, noColorFlag: true, noColor: true, tty: true, want: false},
+		{mode: colorAuto, noColorFlag: true, noColor: true, tty: false, want: false},
+
+		// --color=never never colors
+		{mode: colorNever, tty: true, want: false},
+		{mode: colorNever, tty: false, want: false},
+		{mode: colorNever, noColorFlag: true, tty: true, want: false},
+		{mode: colorNever, noColorFlag: true, tty: false, want: false},
+		{mode: colorNever, noColor: true, tty: true, want: false},
+		{mode: colorNever, noColor: true, tty: false, want: false},
+		{mode: colorNever, noColorFlag: true, noColor: true, tty: true, want: false},
+		{mode: colorNever, noColorFlag: true, noColor: true, tty: false, want: false},
+	}
+	for _, tt := range tests {
+		if got := colorEnabled(tt.mode, tt.noColorFlag, tt.noColor, tt.tty); got != tt.want {
+			t.Errorf("colorEnabled(%q, no-color %v, NO_COLOR %v, tty %v) = %v, want %v",
+				tt.mode, tt.noColorFlag, tt.noColor, tt.tty, got, tt.want)
+		}
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	setGlobal(t, &colorMode, colorAuto)
+
+	// A buffer is not a terminal, so only --color=always colors it, even
+	// with NO_COLOR set
+	t.Setenv("NO_COLOR", "1")
+	var out bytes.Buffer
+	for mode, want := range map[string]bool{colorAuto: false, colorAlways: true, colorNever: false} {
+		colorMode = mode
+		if got := useColor(&out); got != want {
+			t.Errorf("useColor with --color=%s = %v, want %v", mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// column describes a column of the arrivals table
+type column struct {
+	Name   string
+	Header string
+	// Width is the padded width of the column, unless it is the last one
+	Width int
+	// Value returns the plain text of the cell
+	Value func(arrival Arrival, stopIDToName map[string]string, now time.Time) string
+	// Decorate optionally adds escape sequences around the cell text
+	Decorate func(arrival Arrival, text string) string
+}
+
+// columnRegistry lists every column that --columns can select
+var columnRegistry = []column{
+	{Name: "stop_id", Header: "STOP_ID", Width: 10, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return a.StopID
+	}},
+	{Name: "route", Header: "ROUTE", Width: 8, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return a.RouteID
+	}, Decorate: func(a Arrival, text string) string {
+		return colorRoute(text)
+	}},
+	{Name: "station", Header: "STATION", Width: 35, Value: func(a Arrival, names map[string]string, _ time.Time) string {
+		name, _ := lookupStationName(a.StopID, names)
+		return name
+	}, Decorate: func(a Arrival, text string) string {
+		if url, ok := stopLinks[a.StopID]; ok {
+			return hyperlink(url, text)
+		}
+		return text
+	}},
+	{Name: "minutes", Header: "AWAY", Width: 7, Value: func(a Arrival, _ map[string]string, now time.Time) string {
+		return formatMinutesAway(a.Arrival, now)
+	}},
+	{Name: "arrival", Header: "ARRIVAL_TIME", Width: 14, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatArrivalTime(a)
+	}},
+	{Name: "direction", Header: "DIR", Width: 4, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		if direction := stopDirection(a.StopID); direction != "" {
+			return direction
+		}
+		return "-"
+	}},
+	{Name: "destination", Header: "DESTINATION", Width: 35, Value: func(a Arrival, names map[string]string, _ time.Time) string {
+		if a.Destination == "" {
+			return "-"
+		}
+		name, _ := lookupStationName(a.Destination, names)
+		return name
+	}},
+	{Name: "delay", Header: "DELAY", Width: 7, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatDelay(a.Delay)
+	}},
+	{Name: "vs_schedule", Header: "VS_SCHEDULE", Width: 26, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatScheduleDelta(a)
+	}},
+	{Name: "trip", Header: "TRIP", Width: 40, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatTrip(a)
+	}},
+	{Name: "track", Header: "TRACK", Width: 6, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatTrack(a)
+	}},
+	{Name: "stops_away", Header: "STOPS_AWAY", Width: 11, Value: func(a Arrival, _ map[string]string, _ time.Time) string {
+		return formatStopsAway(a)
+	}},
+}
+
+// defaultColumns is the layout used without --columns
+var defaultColumns = []string{"stop_id", "route", "station", "minutes", "arrival"}
+
+// tableColumns holds the columns of the arrivals table, set from --columns
+var tableColumns []column
+
+// selectColumns looks up the named columns in the registry, in order
+func selectColumns(names []string) ([]column, error) {
+	var selected []column
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, col := range columnRegistry {
+			if col.Name == name {
+				selected = append(selected, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			var known []string
+			for _, col := range columnRegistry {
+				known = append(known, col.Name)
+			}
+			return nil, fmt.Errorf("unknown column %q, expected one of: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// formatDelay formats the delay reported by the feed, e.g. "+2m" or "-30s"
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay == 0:
+		return "-"
+	case delay > 0:
+		return "+" + formatShortDuration(delay)
+	default:
+		return "-" + formatShortDuration(-delay)
+	}
+}
+
+// formatScheduleDelta compares a prediction with the scheduled time of its
+// trip, e.g. "sched 3:02 PM, +4m late", or "-" if the trip wasn't matched
+func formatScheduleDelta(arrival Arrival) string {
+	if arrival.ScheduledAt.IsZero() {
+		return "-"
+	}
+	scheduled := "sched " + formatClock(arrival.ScheduledAt)
+	delta := arrival.Arrival.Sub(arrival.ScheduledAt).Round(time.Minute)
+	switch {
+	case delta > 0:
+		return fmt.Sprintf("%s, +%dm late", scheduled, int(delta.Minutes()))
+	case delta < 0:
+		return fmt.Sprintf("%s, %dm early", scheduled, int(-delta.Minutes()))
+	}
+	return scheduled + ", on time"
+}
+
+// formatShortDuration formats a positive duration in whole minutes, or in
+// seconds if it is under a minute
+func formatShortDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// writeTableRow writes the cells of a table row to w, padding every column
+// but the last. Padding is computed from the plain text, so that escape
+// sequences added by decorate don't break the alignment.
+func writeTableRow(w io.Writer, columns []column, cell func(col column) (plain, decorated string)) {
+	for i, col := range columns {
+		if i > 0 {
+			fmt.Fprint(w, " ")
+		}
+		plain, decorated := cell(col)
+		if i == len(columns)-1 {
+			fmt.Fprint(w, decorated)
+			continue
+		}
+		fmt.Fprint(w, decorated+padRight(plain, col.Width)[len(plain):])
+	}
+}
+
+// minNameWidth is the narrowest --name-width that leaves a readable name
+const minNameWidth = 5
+
+// nameAbbreviations shorten common words of station names, in the style the
+// MTA already uses for most names ("Av", "St", "Blvd")
+var nameAbbreviations = map[string]string{
+	"Avenue":       "Av",
+	"Street":       "St",
+	"Boulevard":    "Blvd",
+	"Parkway":      "Pkwy",
+	"Square":       "Sq",
+	"Center":       "Ctr",
+	"Heights":      "Hts",
+	"Junction":     "Jct",
+	"College":      "Coll",
+	"University":   "Univ",
+	"Terminal":     "Term",
+	"Airport":      "Arpt",
+	"Metropolitan": "Metro",
+}
+
+// nameWordPattern matches the words of a station name, which may be joined
+// by spaces, hyphens, or slashes, e.g. "Jamaica Center-Parsons/Archer"
+var nameWordPattern = regexp.MustCompile(`[A-Za-z]+`)
+
+// abbreviateName shortens a station name to at most width characters. It
+// abbreviates common words, then drops a parenthesized suffix such as
+// "(110 St)", and as a last resort replaces the middle of the name with an
+// ellipsis so that both ends stay recognizable.
+func abbreviateName(name string, width int) string {
+	fits := func(s string) bool { return utf8.RuneCountInString(s) <= width }
+	if width <= 0 || fits(name) {
+		return name
+	}
+
+	name = nameWordPattern.ReplaceAllStringFunc(name, func(word string) string {
+		if short, ok := nameAbbreviations[word]; ok {
+			return short
+		}
+		return word
+	})
+	if fits(name) {
+		return name
+	}
+
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		name = name[:i]
+		if fits(name) {
+			return name
+		}
+	}
+
+	runes := []rune(name)
+	head := width / 2
+	tail := width - 1 - head
+	return strings.TrimRight(string(runes[:head]), " -/") + "…" + strings.TrimLeft(string(runes[len(runes)-tail:]), " -/")
+}
+
+// withNameWidth returns columns with the station and destination columns
+// narrowed to width, but no narrower than their headers, abbreviating names
+// that don't fit
+func withNameWidth(columns []column, width int) []column {
+	narrowed := make([]column, len(columns))
+	for i, col := range columns {
+		if col.Name == "station" || col.Name == "destination" {
+			value := col.Value
+			col.Value = func(a Arrival, names map[string]string, now time.Time) string {
+				return abbreviateName(value(a, names, now), width)
+			}
+			col.Width = max(width, len(col.Header))
+		}
+		narrowed[i] = col
+	}
+	return narrowed
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAbbreviateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{name: "Times Sq-42 St", width: 20, want: "Times Sq-42 St"},
+		// Common words are abbreviated first
+		{name: "116 St-Columbia University", width: 20, want: "116 St-Columbia Univ"},
+		{name: "Metropolitan Av", width: 12, want: "Metro Av"},
+		// then a parenthesized suffix is dropped
+		{name: "Cathedral Pkwy (110 St)", width: 20, want: "Cathedral Pkwy"},
+		// and as a last resort the middle gives way to an ellipsis
+		{name: "Van Cortlandt Park-242 St", width: 20, want: "Van Cortla…rk-242 St"},
+		{name: "Sutphin Blvd-Archer Av-JFK Airport", width: 20, want: "Sutphin Bl…JFK Arpt"},
+		{name: "Jamaica Center-Parsons/Archer", width: 24, want: "Jamaica Ctr…sons/Archer"},
+		{name: "Coney Island-Stillwell Av", width: 12, want: "Coney…ll Av"},
+		{name: "Jackson Hts-Roosevelt Av", width: 0, want: "Jackson Hts-Roosevelt Av"},
+	}
+	for _, tt := range tests {
+		got := abbreviateName(tt.name, tt.width)
+		if got != tt.want {
+			t.Errorf("abbreviateName(%q, %d) = %q, want %q", tt.name, tt.width, got, tt.want)
+		}
+		if tt.width > 0 && len([]rune(got)) > tt.width {
+			t.Errorf("abbreviateName(%q, %d) is %d characters", tt.name, tt.width, len([]rune(got)))
+		}
+	}
+}
+
+func TestDisplayArrivalsNameWidth(t *testing.T) {
+	columns, err := selectColumns(defaultColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &tableColumns, withNameWidth(columns, 20))
+	setGlobal(t, &asOf, fixtureTime)
+	setGlobal(t, &colorOutput, false)
+
+	stopIDToName, _, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrivals := parseArrivals(loadFeedFixture(t, "gtfs.pb"), nil, fixtureTime, false)
+
+	var out bytes.Buffer
+	displayArrivals(&out, arrivals, stopIDToName)
+	checkGolden(t, "arrivals_name_width.golden", out.Bytes())
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compactPerRoute is how many upcoming trains are shown per route in compact mode
+const compactPerRoute = 3
+
+// formatMinutesList formats the minutes until the next few arrivals,
+// soonest first, e.g. "2,7m"
+func formatMinutesList(arrivals []Arrival, now time.Time) string {
+	sorted := append([]Arrival{}, arrivals...)
+	sortArrivals(sorted)
+	if len(sorted) > compactPerRoute {
+		sorted = sorted[:compactPerRoute]
+	}
+
+	minutes := make([]string, len(sorted))
+	for i, arrival := range sorted {
+		minutes[i] = strconv.Itoa(max(int(arrival.Arrival.Sub(now).Minutes()), 0))
+	}
+	return strings.Join(minutes, ",") + "m"
+}
+
+// formatCompactLine condenses a station's arrivals into a single line,
+// e.g. "96 St | 1: 2,7m | 2: 5m | 3: 9m". Routes are ordered by route ID
+// and each lists the minutes until its next few trains.
+func formatCompactLine(group StationGroup, now time.Time) string {
+	byRoute := make(map[string][]Arrival)
+	var routeIDs []string
+	for _, arrival := range group.Arrivals {
+		if _, ok := byRoute[arrival.RouteID]; !ok {
+			routeIDs = append(routeIDs, arrival.RouteID)
+		}
+		byRoute[arrival.RouteID] = append(byRoute[arrival.RouteID], arrival)
+	}
+	sort.Strings(routeIDs)
+
+	parts := []string{group.Station}
+	for _, routeID := range routeIDs {
+		parts = append(parts, fmt.Sprintf("%s: %s", colorRoute(routeID), formatMinutesList(byRoute[routeID], now)))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// displayCompact writes one line per station to w
+func displayCompact(w io.Writer, groups []StationGroup, now time.Time) {
+	for _, group := range groups {
+		fmt.Fprintln(w, formatCompactLine(group, now))
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDisplayCompact(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+	in := func(minutes float64) time.Time { return now.Add(time.Duration(minutes * float64(time.Minute))) }
+
+	stopIDToName := map[string]string{
+		"120N": "96 St", "120S": "96 St",
+		"625N": "96 St", "625S": "96 St",
+		"117S": "116 St-Columbia University",
+		"127S": "Times Sq-42 St",
+	}
+	arrivals := []Arrival{
+		{StopID: "120S", RouteID: "2", Arrival: in(5.5)},
+		{StopID: "120N", RouteID: "1", Arrival: in(7)},
+		{StopID: "120S", RouteID: "1", Arrival: in(2.9)},
+		{StopID: "625N", RouteID: "6", Arrival: in(8)},
+		{StopID: "120N", RouteID: "1", Arrival: in(12)},
+		{StopID: "120S", RouteID: "1", Arrival: in(15)},
+		{StopID: "120S", RouteID: "3", Arrival: in(9)},
+		{StopID: "117S", RouteID: "1", Arrival: in(3)},
+		// Already departed trains show as 0
+		{StopID: "127S", RouteID: "2", Arrival: in(-0.5)},
+		{StopID: "127S", RouteID: "7", Arrival: in(1)},
+	}
+
+	var out bytes.Buffer
+	displayCompact(&out, groupByStation(arrivals, stopIDToName), now)
+	checkGolden(t, "compact.golden", out.Bytes())
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Config holds user settings loaded from the config file
+type Config struct {
+	// Labels maps stop IDs to custom labels shown instead of the GTFS stop name
+	Labels map[string]string `json:"labels"`
+	// DefaultStation is queried when no station argument is given
+	DefaultStation string `json:"default_station"`
+	// Feeds adds GTFS-Realtime feeds to the built-in MTA registry
+	Feeds []FeedConfig `json:"feeds"`
+}
+
+// FeedConfig describes a custom GTFS-Realtime feed in the config file
+type FeedConfig struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Routes []string `json:"routes"`
+	// Headers are sent with every request; $VAR and ${VAR} in values are
+	// expanded from the environment, so API keys needn't be stored in the file
+	Headers map[string]string `json:"headers"`
+	// Default makes this the feed fetched when no routes are requested
+	Default bool `json:"default"`
+}
+
+// defaultStationEnv names the environment variable holding the default station
+const defaultStationEnv = "MTA_DEFAULT_STATION"
+
+// defaultConfigPath returns the default config file location,
+// e.g. ~/.config/mta-cli/config.json on Linux
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mta-cli", "config.json")
+}
+
+// LoadConfig reads the JSON config file at path.
+// A missing file is not an error and yields an empty config.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := validateFeedConfigs(config.Feeds); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validateFeedConfigs checks that every custom feed has a unique name, an
+// HTTP(S) URL, and at least one route, that no route is served by two
+// custom feeds, and that at most one is the default
+func validateFeedConfigs(configs []FeedConfig) error {
+	names := make(map[string]bool)
+	routeFeeds := make(map[string]string)
+	defaults := 0
+	for i, fc := range configs {
+		if fc.Name == "" {
+			return fmt.Errorf("feed %d: missing name", i+1)
+		}
+		if names[fc.Name] {
+			return fmt.Errorf("feed %s: duplicate name", fc.Name)
+		}
+		names[fc.Name] = true
+
+		u, err := url.Parse(fc.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("feed %s: invalid url %q, expected an http or https URL", fc.Name, fc.URL)
+		}
+
+		if len(fc.Routes) == 0 {
+			return fmt.Errorf("feed %s: no routes", fc.Name)
+		}
+		for _, route := range fc.Routes {
+			route = normalizeRoute(route)
+			if route == "" {
+				return fmt.Errorf("feed %s: empty route", fc.Name)
+			}
+			if other, ok := routeFeeds[route]; ok {
+				return fmt.Errorf("feed %s: route %s is already served by feed %s", fc.Name, route, other)
+			}
+			routeFeeds[route] = fc.Name
+		}
+
+		for name := range fc.Headers {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("feed %s: empty header name", fc.Name)
+			}
+		}
+
+		if fc.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return errors.New("more than one feed is marked as the default")
+	}
+	return nil
+}
+
+// applyFeedConfigs merges the custom feeds into the feed registry. A route
+// served by a custom feed is no longer looked up in the built-in feed that
+// served it, and built-in feeds left without routes are dropped. The
+// default feed is the custom one marked as such, else the built-in default
+// if it survives, else the feed taking over its routes.
+func applyFeedConfigs(configs []FeedConfig) {
+	if len(configs) == 0 {
+		return
+	}
+
+	custom := make(map[string]bool)
+	for _, fc := range configs {
+		for _, route := range fc.Routes {
+			custom[normalizeRoute(route)] = true
+		}
+	}
+
+	var merged []Feed
+	replaced := defaultFeed
+	defaultSet := false
+	for _, feed := range feeds {
+		var routes []string
+		for _, route := range feed.Routes {
+			if !custom[route] {
+				routes = append(routes, route)
+			}
+		}
+		if len(routes) == 0 {
+			continue
+		}
+		feed.Routes = routes
+		merged = append(merged, feed)
+		if feed.Name == defaultFeed.Name {
+			defaultFeed = feed
+			defaultSet = true
+		}
+	}
+
+	for _, fc := range configs {
+		feed := Feed{Name: fc.Name, URL: fc.URL}
+		for _, route := range fc.Routes {
+			feed.Routes = append(feed.Routes, normalizeRoute(route))
+		}
+		if len(fc.Headers) > 0 {
+			feed.Headers = make(map[string]string, len(fc.Headers))
+			for name, value := range fc.Headers {
+				feed.Headers[name] = os.ExpandEnv(value)
+			}
+		}
+		merged = append(merged, feed)
+		if fc.Default {
+			defaultFeed = feed
+			defaultSet = true
+		}
+	}
+	feeds = merged
+
+	// Every route of the default feed moved to custom feeds: the first one
+	// taking over any of them becomes the default, or else the first feed
+	if !defaultSet {
+		defaultFeed = merged[0]
+		for _, feed := range merged {
+			if slices.ContainsFunc(feed.Routes, func(route string) bool { return slices.Contains(replaced.Routes, route) }) {
+				defaultFeed = feed
+				break
+			}
+		}
+	}
+}
+
+// defaultStation picks the station to query: the positional argument,
+// then the environment variable, then the config file. An empty result
+// means all stations.
+func defaultStation(args []string, env string, config Config) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	if env = strings.TrimSpace(env); env != "" {
+		return env
+	}
+	return strings.TrimSpace(config.DefaultStation)
+}
+
+// parseLabels parses id=name pairs into a stop ID -> label map
+func parseLabels(pairs []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range pairs {
+		id, name, ok := strings.Cut(pair, "=")
+		if !ok || id == "" || name == "" {
+			return nil, fmt.Errorf("invalid label %q, expected id=name", pair)
+		}
+		labels[id] = name
+	}
+	return labels, nil
+}
+
+// applyLabels returns a copy of stopIDToName with the custom labels taking precedence
+func applyLabels(stopIDToName map[string]string, labels ...map[string]string) map[string]string {
+	named := make(map[string]string, len(stopIDToName))
+	for id, name := range stopIDToName {
+		named[id] = name
+	}
+	for _, set := range labels {
+		for id, label := range set {
+			named[id] = label
+		}
+	}
+	return named
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import "testing"
+
+func TestApplyFeedConfigsDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []FeedConfig
+		want    string // name of the default feed
+		wantURL string
+	}{
+		{
+			name:    "default keeps its other routes",
+			configs: []FeedConfig{{Name: "mine", URL: "http://localhost/1", Routes: []string{"1"}}},
+			want:    "1234567S",
+		},
+		{
+			name: "default replaced",
+			configs: []FeedConfig{
+				{Name: "lettered", URL: "http://localhost/l", Routes: []string{"L"}},
+				{Name: "numbered", URL: "http://localhost/n", Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}},
+			},
+			want:    "numbered",
+			wantURL: "http://localhost/n",
+		},
+		{
+			name: "marked default",
+			configs: []FeedConfig{
+				{Name: "numbered", URL: "http://localhost/n", Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}},
+				{Name: "lettered", URL: "http://localhost/l", Routes: []string{"L"}, Default: true},
+			},
+			want: "lettered",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFeeds(t, feeds)
+			applyFeedConfigs(tt.configs)
+			if defaultFeed.Name != tt.want {
+				t.Errorf("default feed = %s, want %s", defaultFeed.Name, tt.want)
+			}
+			if tt.wantURL != "" && defaultFeed.URL != tt.wantURL {
+				t.Errorf("default feed URL = %s, want %s", defaultFeed.URL, tt.wantURL)
+			}
+			if tt.want == "1234567S" && len(defaultFeed.Routes) != 7 {
+				t.Errorf("default feed routes = %v, want the seven other than 1", defaultFeed.Routes)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// enableVirtualTerminalProcessing makes the Windows console interpret ANSI
+// escape sequences (ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+const enableVirtualTerminalProcessing = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// enableEscapes turns on escape sequence processing for the console f and
+// reports whether escape sequences will work. Consoles older than
+// Windows 10 don't support it.
+func enableEscapes(f *os.File) bool {
+	handle := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(handle, &mode); err != nil {
+		// Not a console, e.g. a mintty pipe, which handles escapes itself
+		return true
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	ok, _, _ := procSetConsoleMode.Call(uintptr(handle), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
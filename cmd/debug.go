@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	debugFromFile  string
+	debugRoutes    []string
+	debugStopsJSON bool
+)
+
+// loadFeedFile reads a GTFS-Realtime protobuf message saved to a file
+func loadFeedFile(path string) (*gtfs.FeedMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed file: %w", err)
+	}
+	feed := &gtfs.FeedMessage{}
+	if err := proto.Unmarshal(data, feed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	return feed, nil
+}
+
+// filterTripUpdates keeps only the trip updates for the given routes
+// (all routes if nil), dropping every other entity
+func filterTripUpdates(feed *gtfs.FeedMessage, routes map[string]bool) {
+	var kept []*gtfs.FeedEntity
+	for _, entity := range feed.GetEntity() {
+		tripUpdate := entity.GetTripUpdate()
+		if tripUpdate == nil {
+			continue
+		}
+		if routes != nil && !routes[normalizeRoute(baseRoute(tripUpdate.GetTrip().GetRouteId()))] {
+			continue
+		}
+		kept = append(kept, entity)
+	}
+	feed.Entity = kept
+}
+
+// printFeedJSON prints a feed message as indented JSON
+func printFeedJSON(feed *gtfs.FeedMessage) error {
+	data, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(feed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal feed: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Tools for diagnosing feed and stop data problems",
+}
+
+var debugFeedCmd = &cobra.Command{
+	Use:   "feed",
+	Short: "Print the raw GTFS-Realtime feed as JSON",
+	Long: `Fetches the GTFS-Realtime feed and prints the whole message as JSON,
+including the fields the arrivals view discards. Useful for diagnosing
+missing or odd arrivals.
+
+With --routes, only the trip updates for those routes are printed, and the
+feeds serving them are fetched. With --from-file, a saved protobuf message is
+read instead of fetching.
+
+Examples:
+  mta-cli debug feed                          # The A Division feed
+  mta-cli debug feed --routes A               # Trip updates for the A
+  mta-cli debug feed --from-file feed.pb      # A saved feed`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		applyFeedConfigs(config.Feeds)
+
+		debugRoutes = expandRouteGroups(debugRoutes)
+		var wanted map[string]bool
+		if len(debugRoutes) > 0 {
+			wanted = routeSet(debugRoutes)
+		}
+
+		// A saved feed replaces fetching entirely
+		if debugFromFile != "" {
+			feed, err := loadFeedFile(debugFromFile)
+			if err != nil {
+				return err
+			}
+			if wanted != nil {
+				filterTripUpdates(feed, wanted)
+			}
+			return printFeedJSON(feed)
+		}
+
+		selected := []Feed{defaultFeed}
+		if len(debugRoutes) > 0 {
+			var err error
+			selected, err = feedsForRoutes(debugRoutes)
+			if err != nil {
+				return err
+			}
+		}
+
+		client := &http.Client{Timeout: 30 * time.Second}
+		for _, source := range selected {
+			feed, err := fetchFeedMessage(cmd.Context(), client, source)
+			if err != nil {
+				return fmt.Errorf("%s feed: %w", source.Name, err)
+			}
+			if wanted != nil {
+				filterTripUpdates(feed, wanted)
+			}
+			if err := printFeedJSON(feed); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var debugStopsCmd = &cobra.Command{
+	Use:   "stops",
+	Short: "Print the stop maps loaded from the stops file",
+	Long: `Loads the stops file the way every other command does and prints what was
+parsed, to track down station names or stop IDs that don't resolve as
+expected. The default output is CSV with one stop_id,stop_name row per stop,
+sorted by stop ID. With --json, both lookup maps are printed: id_to_name,
+and name_to_ids, which lists the stop IDs sharing each name.
+
+Examples:
+  mta-cli debug stops                                 # CSV of the bundled stops
+  mta-cli debug stops --json                          # Both maps as JSON
+  mta-cli debug stops --stops-file gtfs.zip --json    # What a GTFS archive yields`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		stopIDToName, nameToIDs, err := LoadStopMaps(stopsFile)
+		if err != nil {
+			return err
+		}
+		return printStopMaps(os.Stdout, stopIDToName, nameToIDs, debugStopsJSON)
+	},
+}
+
+// printStopMaps writes the stop maps to w as CSV rows of stop_id,stop_name,
+// or as a JSON object holding both maps
+func printStopMaps(w io.Writer, stopIDToName map[string]string, nameToIDs map[string][]string, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]any{"id_to_name": stopIDToName, "name_to_ids": nameToIDs}); err != nil {
+			return fmt.Errorf("failed to encode stops: %w", err)
+		}
+		return nil
+	}
+
+	ids := make([]string, 0, len(stopIDToName))
+	for id := range stopIDToName {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"stop_id", "stop_name"})
+	for _, id := range ids {
+		writer.Write([]string{id, stopIDToName[id]})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write stops: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(debugFeedCmd)
+	debugCmd.AddCommand(debugStopsCmd)
+	debugStopsCmd.Flags().BoolVar(&debugStopsJSON, "json", false, "Print the id_to_name and name_to_ids maps as JSON")
+	debugFeedCmd.Flags().StringVar(&debugFromFile, "from-file", "", "Read a saved GTFS-Realtime protobuf message instead of fetching")
+	debugFeedCmd.Flags().StringSliceVarP(&debugRoutes, "routes", "r", nil, "Only print the trip updates for these routes, e.g. 1,2,3, A,C,E, or a group such as reds")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// tripModificationsField is the field number of FeedEntity.trip_modifications,
+// which describes detours. The bindings predate it, so it is read from the
+// entities' unknown fields.
+const tripModificationsField protowire.Number = 8
+
+// Fields of TripModifications and TripModifications.SelectedTrips
+const (
+	selectedTripsField   protowire.Number = 1
+	selectedTripIDsField protowire.Number = 1
+)
+
+// modifiedTripIDs returns the IDs of the trips that the feed's trip
+// modifications apply to. Feeds without any, or with malformed ones, yield none.
+func modifiedTripIDs(feed *gtfs.FeedMessage) []string {
+	var tripIDs []string
+	for _, entity := range feed.GetEntity() {
+		for _, modifications := range unknownFieldValues(entity.ProtoReflect().GetUnknown(), tripModificationsField) {
+			for _, selected := range unknownFieldValues(modifications, selectedTripsField) {
+				for _, tripID := range unknownFieldValues(selected, selectedTripIDsField) {
+					tripIDs = append(tripIDs, string(tripID))
+				}
+			}
+		}
+	}
+	return tripIDs
+}
+
+// reroutedRoutes returns the routes with detoured trips in the feed, sorted,
+// keeping only those in routes unless it is nil. A trip's route comes from
+// its trip update, so modified trips without one are left out.
+func reroutedRoutes(feed *gtfs.FeedMessage, routes map[string]bool) []string {
+	tripIDs := modifiedTripIDs(feed)
+	if len(tripIDs) == 0 {
+		return nil
+	}
+
+	routeOf := make(map[string]string)
+	for _, entity := range feed.GetEntity() {
+		if trip := entity.GetTripUpdate().GetTrip(); trip.GetTripId() != "" {
+			routeOf[trip.GetTripId()] = baseRoute(trip.GetRouteId())
+		}
+	}
+
+	seen := make(map[string]bool)
+	var rerouted []string
+	for _, tripID := range tripIDs {
+		routeID := routeOf[tripID]
+		if routeID == "" || seen[routeID] || (routes != nil && !routes[normalizeRoute(routeID)]) {
+			continue
+		}
+		seen[routeID] = true
+		rerouted = append(rerouted, routeID)
+	}
+	sort.Strings(rerouted)
+	return rerouted
+}
+
+// formatRerouted describes the rerouted routes, e.g. "1 train rerouted"
+// or "1, 2, and A trains rerouted"
+func formatRerouted(routeIDs []string) string {
+	names := make([]string, len(routeIDs))
+	for i, routeID := range routeIDs {
+		names[i] = colorRoute(routeID)
+	}
+	switch len(names) {
+	case 1:
+		return names[0] + " train rerouted"
+	case 2:
+		return names[0] + " and " + names[1] + " trains rerouted"
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", and " + names[len(names)-1] + " trains rerouted"
+}
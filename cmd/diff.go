@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffRoutes    []string
+	diffThreshold time.Duration
+	diffDetails   bool
+)
+
+// Kinds of prediction changes between two feeds
+const (
+	changeAdded   = "+"
+	changeRemoved = "-"
+	changeShifted = "~"
+)
+
+// predictionChange is a prediction that differs between two feeds, matched
+// by trip and stop. Old is unset for added predictions and New for removed ones.
+type predictionChange struct {
+	Kind string
+	Old  Arrival
+	New  Arrival
+}
+
+// Shift returns how far a shifted prediction moved; positive is later
+func (c predictionChange) Shift() time.Duration {
+	return c.New.Arrival.Sub(c.Old.Arrival)
+}
+
+// routeDiff counts the changes of one route
+type routeDiff struct {
+	RouteID  string
+	Added    int
+	Removed  int
+	Shifted  int
+	MaxShift time.Duration // largest shift either way, with its sign
+}
+
+// diffPredictions compares the predictions of two feeds. Predictions that
+// moved by threshold or less count as unchanged. Changes are ordered by
+// route, then by time.
+func diffPredictions(old, current []Arrival, threshold time.Duration) []predictionChange {
+	before := make(map[string]Arrival, len(old))
+	for _, arrival := range old {
+		before[arrivalKey(arrival)] = arrival
+	}
+
+	var changes []predictionChange
+	seen := make(map[string]bool, len(current))
+	for _, arrival := range current {
+		key := arrivalKey(arrival)
+		seen[key] = true
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			changes = append(changes, predictionChange{Kind: changeAdded, New: arrival})
+		case arrival.Arrival.Sub(previous.Arrival) > threshold || previous.Arrival.Sub(arrival.Arrival) > threshold:
+			changes = append(changes, predictionChange{Kind: changeShifted, Old: previous, New: arrival})
+		}
+	}
+	for _, arrival := range old {
+		if !seen[arrivalKey(arrival)] {
+			changes = append(changes, predictionChange{Kind: changeRemoved, Old: arrival})
+		}
+	}
+
+	// Removed predictions only have their old side
+	arrival := func(c predictionChange) Arrival {
+		if c.Kind == changeRemoved {
+			return c.Old
+		}
+		return c.New
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := arrival(changes[i]), arrival(changes[j])
+		if a.RouteID != b.RouteID {
+			return a.RouteID < b.RouteID
+		}
+		return a.Arrival.Before(b.Arrival)
+	})
+	return changes
+}
+
+// summarizeChanges counts the changes per route, ordered by route
+func summarizeChanges(changes []predictionChange) []routeDiff {
+	var summary []routeDiff
+	index := make(map[string]int)
+	for _, change := range changes {
+		routeID := change.New.RouteID
+		if change.Kind == changeRemoved {
+			routeID = change.Old.RouteID
+		}
+		i, ok := index[routeID]
+		if !ok {
+			i = len(summary)
+			index[routeID] = i
+			summary = append(summary, routeDiff{RouteID: routeID})
+		}
+		switch change.Kind {
+		case changeAdded:
+			summary[i].Added++
+		case changeRemoved:
+			summary[i].Removed++
+		case changeShifted:
+			summary[i].Shifted++
+			if shift := change.Shift(); shift.Abs() > summary[i].MaxShift.Abs() {
+				summary[i].MaxShift = shift
+			}
+		}
+	}
+	return summary
+}
+
+// formatShift formats a shift in predicted time, e.g. "+3m" or "-45s"
+func formatShift(shift time.Duration) string {
+	if shift == 0 {
+		return "-"
+	}
+	return formatDelay(shift)
+}
+
+// printFeedDiff writes the per-route summary of the changes to w, followed
+// by every change if details is set
+func printFeedDiff(w io.Writer, changes []predictionChange, stopIDToName map[string]string, details bool) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No predictions changed.")
+		return
+	}
+
+	fmt.Fprintf(w, "%-8s %-8s %-8s %-8s %s\n", "ROUTE", "ADDED", "REMOVED", "SHIFTED", "MAX_SHIFT")
+	var total routeDiff
+	for _, route := range summarizeChanges(changes) {
+		fmt.Fprintf(w, "%s %-8d %-8d %-8d %s\n", colorRoute(route.RouteID)+padRight(route.RouteID, 8)[len(route.RouteID):],
+			route.Added, route.Removed, route.Shifted, formatShift(route.MaxShift))
+		total.Added += route.Added
+		total.Removed += route.Removed
+		total.Shifted += route.Shifted
+	}
+	fmt.Fprintf(w, "\nTotal: %d added, %d removed, %d shifted\n", total.Added, total.Removed, total.Shifted)
+
+	if !details {
+		return
+	}
+	fmt.Fprintln(w)
+	for _, change := range changes {
+		arrival := change.New
+		when := formatClock(arrival.Arrival)
+		switch change.Kind {
+		case changeRemoved:
+			arrival = change.Old
+			when = formatClock(arrival.Arrival)
+		case changeShifted:
+			when = fmt.Sprintf("%s -> %s (%s)", formatClock(change.Old.Arrival), when, formatShift(change.Shift()))
+		}
+		station, _ := lookupStationName(arrival.StopID, stopIDToName)
+		fmt.Fprintf(w, "%s %-3s %-6s %-30s %s  trip %s\n", change.Kind, arrival.RouteID, arrival.StopID, station, when, arrival.TripID)
+	}
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <old.pb> <new.pb>",
+	Short: "Compare the predictions of two saved feeds",
+	Long: `Compares two saved GTFS-Realtime protobuf messages, such as two downloads
+of the same feed a minute apart, and reports how the predictions changed.
+Predictions are matched by trip and stop: a prediction is added or removed
+when only one feed has it, and shifted when its time moved by more than
+--threshold.
+
+A summary per route is printed; --details lists every change as well.
+
+Examples:
+  mta-cli diff old.pb new.pb                  # Per-route summary
+  mta-cli diff old.pb new.pb --details        # Every added, removed, and shifted prediction
+  mta-cli diff old.pb new.pb --routes 1 --threshold 30s`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		diffRoutes = expandRouteGroups(diffRoutes)
+		var wanted map[string]bool
+		if len(diffRoutes) > 0 {
+			wanted = routeSet(diffRoutes)
+		}
+
+		var predictions [2][]Arrival
+		for i, path := range args {
+			feed, err := loadFeedFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			// Keep past predictions too: saved feeds are usually old
+			predictions[i] = parseArrivals(feed, wanted, time.Time{}, false)
+
+			line := fmt.Sprintf("%s: %d predictions", path, len(predictions[i]))
+			if timestamp := feed.GetHeader().GetTimestamp(); timestamp != 0 {
+				line += ", feed time " + formatClockSeconds(time.Unix(int64(timestamp), 0))
+			}
+			fmt.Println(line)
+		}
+		fmt.Println()
+
+		stopIDToName, _, err := CachedStopMaps(stopsFile)
+		if err != nil {
+			fmt.Printf("Warning: Could not load stop names: %v\n", err)
+		}
+
+		colorOutput = useColor(os.Stdout)
+		printFeedDiff(os.Stdout, diffPredictions(predictions[0], predictions[1], diffThreshold), stopIDToName, diffDetails)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringSliceVarP(&diffRoutes, "routes", "r", nil, "Only compare these routes, e.g. 1,2,3, A,C,E, or a group such as reds")
+	diffCmd.Flags().DurationVar(&diffThreshold, "threshold", 0, "Ignore predictions that moved by this much or less")
+	diffCmd.Flags().BoolVar(&diffDetails, "details", false, "List every changed prediction after the summary")
+}
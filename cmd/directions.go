@@ -0,0 +1,43 @@
+package cmd
+
+// routeDirectionLabels are the northbound and southbound directions of
+// each route as the station signs put them. Routes missing here, and
+// those whose ends are hard to name in a few words, are shown as N and S.
+var routeDirectionLabels = map[string][2]string{
+	"1":  {"Uptown & The Bronx", "Downtown"},
+	"2":  {"Uptown & The Bronx", "Downtown & Brooklyn"},
+	"3":  {"Uptown", "Downtown & Brooklyn"},
+	"4":  {"Uptown & The Bronx", "Downtown & Brooklyn"},
+	"5":  {"Uptown & The Bronx", "Downtown & Brooklyn"},
+	"6":  {"Uptown & The Bronx", "Downtown"},
+	"7":  {"Queens", "Manhattan"},
+	"A":  {"Uptown", "Downtown & Brooklyn"},
+	"C":  {"Uptown", "Downtown & Brooklyn"},
+	"E":  {"Queens", "Downtown"},
+	"B":  {"Uptown & The Bronx", "Downtown & Brooklyn"},
+	"D":  {"Uptown & The Bronx", "Downtown & Brooklyn"},
+	"F":  {"Queens", "Downtown & Brooklyn"},
+	"G":  {"Queens", "Brooklyn"},
+	"L":  {"Manhattan", "Brooklyn"},
+	"N":  {"Uptown & Queens", "Downtown & Brooklyn"},
+	"Q":  {"Uptown", "Downtown & Brooklyn"},
+	"R":  {"Uptown & Queens", "Downtown & Brooklyn"},
+	"W":  {"Uptown & Queens", "Downtown"},
+	"SI": {"St George", "Tottenville"},
+}
+
+// directionLabel returns the sign wording for a route in the direction
+// of a stop ID suffix, or the suffix itself when the route has none
+func directionLabel(routeID, direction string) string {
+	labels, ok := routeDirectionLabels[routeID]
+	if !ok {
+		return direction
+	}
+	switch direction {
+	case "N":
+		return labels[0]
+	case "S":
+		return labels[1]
+	}
+	return direction
+}
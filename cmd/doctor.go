@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// checkResult is the outcome of a single doctor check
+type checkResult struct {
+	Name string
+	Err  error
+}
+
+// checkFeed verifies that a feed endpoint responds with a parseable protobuf message
+func checkFeed(feed Feed) checkResult {
+	result := checkResult{Name: fmt.Sprintf("Feed %s is reachable", feed.Name)}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if _, err := fetchFeedMessage(context.Background(), client, feed); err != nil {
+		result.Err = err
+	}
+	return result
+}
+
+// checkStopsFile verifies that the stops file exists and contains stops
+func checkStopsFile(path string) checkResult {
+	result := checkResult{Name: fmt.Sprintf("Stops file %s is present", path)}
+	stopIDToName, _, err := LoadStopMaps(path)
+	if err != nil {
+		result.Err = err
+	} else if len(stopIDToName) == 0 {
+		result.Err = fmt.Errorf("no stops found")
+	}
+	return result
+}
+
+// checkTimezone verifies that the TZ environment variable, if set, names a valid timezone
+func checkTimezone() checkResult {
+	result := checkResult{Name: "Timezone is valid"}
+	if tz := os.Getenv("TZ"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			result.Err = fmt.Errorf("invalid TZ %q: %w", tz, err)
+		}
+	}
+	return result
+}
+
+// checkConfig verifies that the config file, if present, parses
+func checkConfig(path string) checkResult {
+	result := checkResult{Name: fmt.Sprintf("Config file %s parses", path)}
+	if _, err := LoadConfig(path); err != nil {
+		result.Err = err
+	}
+	return result
+}
+
+// printCheckResults prints a pass/fail checklist and reports whether every check passed
+func printCheckResults(results []checkResult) bool {
+	ok := true
+	for _, result := range results {
+		if result.Err != nil {
+			ok = false
+			fmt.Printf("[FAIL] %s: %v\n", result.Name, result.Err)
+			continue
+		}
+		fmt.Printf("[PASS] %s\n", result.Name)
+	}
+	return ok
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that mta-cli is set up correctly",
+	Long: `Runs a series of checks on the mta-cli setup and prints a pass/fail checklist:
+  - each GTFS-Realtime feed endpoint is reachable and returns a parseable feed
+  - the static stops file is present and non-empty
+  - the configured timezone (TZ) is valid
+  - the config file, if present, parses
+
+Exits with a non-zero status if any check fails.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failed checks are reported in the checklist; a returned error
+		// only carries the exit status
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		// Custom feeds from the config file are checked too; a broken
+		// config is reported by checkConfig below
+		if config, err := LoadConfig(configPath); err == nil {
+			applyFeedConfigs(config.Feeds)
+		}
+
+		var results []checkResult
+		for _, feed := range feeds {
+			results = append(results, checkFeed(feed))
+		}
+		results = append(results, checkStopsFile(stopsFile))
+		results = append(results, checkTimezone())
+		results = append(results, checkConfig(configPath))
+
+		if !printCheckResults(results) {
+			return exitWith(exitError)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
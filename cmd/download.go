@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// staticURL is where the MTA publishes the subway's GTFS static data
+var staticURL = "https://rrgtfsfeeds.s3.amazonaws.com/gtfs_subway.zip"
+
+// assumeYes downloads the static data without asking first
+var assumeYes bool
+
+// staticArchivePath returns where the downloaded static data is kept,
+// e.g. ~/.cache/mta-cli/gtfs_subway.zip on Linux
+func staticArchivePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mta-cli", "gtfs_subway.zip")
+}
+
+// interactive reports whether to ask before downloading: not with
+// --assume-yes, when CI is set, or when in is not a terminal
+func interactive(in io.Reader) bool {
+	if assumeYes || os.Getenv("CI") != "" {
+		return false
+	}
+	f, ok := in.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// confirmDownload asks on w whether to download the static data from url
+// to path, reading the answer from in. size is the download size in bytes,
+// or 0 if unknown. Only "y" or "yes" agree.
+func confirmDownload(in io.Reader, w io.Writer, url, path string, size int64) bool {
+	what := "the MTA GTFS static data"
+	if size > 0 {
+		what += fmt.Sprintf(" (%.1f MB)", float64(size)/1e6)
+	}
+	fmt.Fprintf(w, "Download %s from %s to %s? [y/N] ", what, url, path)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// downloadSize returns the size of the file at url from a HEAD request, or
+// 0 if the server doesn't say
+func downloadSize(ctx context.Context, client *http.Client, url string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return max(resp.ContentLength, 0)
+}
+
+// downloadStatic downloads the static data from url to path. It is written
+// to a temporary file first, so an interrupted download leaves nothing
+// behind.
+func downloadStatic(ctx context.Context, client *http.Client, url, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download static data: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gtfs_subway-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download static data: %w", err)
+	}
+	if !isArchive(tmp.Name()) {
+		return errors.New("downloaded static data is not a zip archive")
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// staticSource returns the static data to read the file name from, such as
+// stop_times.txt: the stops data when it has the file, otherwise the static
+// data downloaded earlier.
+//
+// A missing file is downloaded only when required is set, that is when the
+// command can't do what was asked without it, such as --with-schedule or
+// --reverse. Where the file only adds detail, such as the stop-by-stop view
+// of a line or the routes listed by stations, data downloaded earlier is
+// used but nothing is fetched. The download is confirmed first on a
+// terminal (see interactive). Only the bundled stops data is supplemented
+// this way; a --stops-file of another system is used as is.
+func staticSource(cmd *cobra.Command, name string, required bool) string {
+	if cmd.Flags().Changed("stops-file") {
+		return stopsFile
+	}
+	if file, err := openStaticFile(stopsFile, name); err == nil {
+		file.Close()
+		return stopsFile
+	}
+
+	path := staticArchivePath()
+	if path == "" {
+		return stopsFile
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if !required {
+		return stopsFile
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	errOut := cmd.ErrOrStderr()
+	if interactive(cmd.InOrStdin()) {
+		fmt.Fprintf(errOut, "%s is not installed.\n", name)
+		if !confirmDownload(cmd.InOrStdin(), errOut, staticURL, path, downloadSize(ctx, client, staticURL)) {
+			return stopsFile
+		}
+	}
+	if verbose {
+		fmt.Fprintf(errOut, "Downloading %s to %s\n", staticURL, path)
+	}
+	if err := downloadStatic(ctx, client, staticURL, path); err != nil {
+		fmt.Fprintf(errOut, "Warning: Could not download the static data: %v\n", err)
+		return stopsFile
+	}
+	return path
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfirmDownload(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{answer: "y\n", want: true},
+		{answer: "Yes\n", want: true},
+		{answer: "\n", want: false},
+		{answer: "n\n", want: false},
+		{answer: "", want: false},
+	}
+	for _, tt := range tests {
+		var prompt bytes.Buffer
+		got := confirmDownload(strings.NewReader(tt.answer), &prompt, "https://example.com/gtfs.zip", "/cache/gtfs.zip", 5_200_000)
+		if got != tt.want {
+			t.Errorf("answer %q = %v, want %v", tt.answer, got, tt.want)
+		}
+		if want := "Download the MTA GTFS static data (5.2 MB) from https://example.com/gtfs.zip to /cache/gtfs.zip? [y/N] "; prompt.String() != want {
+			t.Errorf("prompt = %q, want %q", prompt.String(), want)
+		}
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	t.Setenv("CI", "")
+	if interactive(strings.NewReader("y\n")) {
+		t.Error("interactive without a terminal = true, want false")
+	}
+
+	// Both skip the prompt even on a terminal
+	setGlobal(t, &assumeYes, true)
+	if interactive(os.Stdin) {
+		t.Error("interactive with --assume-yes = true, want false")
+	}
+	setGlobal(t, &assumeYes, false)
+	t.Setenv("CI", "true")
+	if interactive(os.Stdin) {
+		t.Error("interactive with CI set = true, want false")
+	}
+}
+
+func TestStaticSource(t *testing.T) {
+	archive, err := os.ReadFile(testArchive(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	setGlobal(t, &staticURL, server.URL)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("CI", "")
+
+	// Stops data without the schedule files next to it
+	stops := filepath.Join(t.TempDir(), "stops.csv")
+	if err := os.WriteFile(stops, readFixture(t, "stops.csv"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &stopsFile, stops)
+
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader(""))
+	cmd.SetErr(new(bytes.Buffer))
+
+	// Where the file only adds detail, nothing is fetched
+	if got := staticSource(cmd, "stop_times.txt", false); got != stops || server.requests.Load() != 0 {
+		t.Fatalf("source = %s after %d requests, want %s without any", got, server.requests.Load(), stops)
+	}
+
+	// Without a terminal, the data is downloaded without asking
+	cached := staticArchivePath()
+	if got := staticSource(cmd, "stop_times.txt", true); got != cached {
+		t.Fatalf("source = %s, want %s", got, cached)
+	}
+	if _, err := LoadSchedule(cached, scheduleStops); err != nil {
+		t.Errorf("loading the downloaded schedule: %v", err)
+	}
+
+	// Once downloaded, it is reused, also where it only adds detail
+	if got := staticSource(cmd, "transfers.txt", true); got != cached || server.requests.Load() != 1 {
+		t.Errorf("source = %s after %d requests, want %s after 1", got, server.requests.Load(), cached)
+	}
+	if got := staticSource(cmd, "trips.txt", false); got != cached {
+		t.Errorf("source = %s, want %s", got, cached)
+	}
+
+	// Files next to the stops data take precedence
+	if got := staticSource(cmd, "stops.csv", true); got != stops {
+		t.Errorf("source = %s, want %s", got, stops)
+	}
+}
+
+func TestDownloadStaticNotArchive(t *testing.T) {
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>maintenance</html>"))
+	})
+	path := filepath.Join(t.TempDir(), "gtfs_subway.zip")
+	if err := downloadStatic(t.Context(), server.Client(), server.URL, path); err == nil {
+		t.Fatal("downloadStatic succeeded, want an error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("a failed download left %s behind", path)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import "fmt"
+
+// Exit statuses of the arrivals command. With --exit-code-map, each
+// outcome has its own status. Without it, an outcome only fails when a flag
+// asks for it, with the statuses scripts relied on before the map:
+//
+//	outcome          without the map                           with it
+//	arrivals         exitOK                                    exitOK
+//	no arrivals      exitError with --fail-on-empty            exitEmpty
+//	unknown station  exitUnknownStation with --strict          exitUnknownStation
+//	stale feed       exitStale with --feed-age-exit            exitStale
+//	fetch error      exitError with --json or --feed-age-exit  exitFetchError
+//
+// Invalid usage exits with exitError either way.
+const (
+	exitOK             = 0 // arrivals found
+	exitError          = 1 // invalid usage or another error
+	exitUnknownStation = 2 // the station doesn't exist or is ambiguous
+	exitEmpty          = 3 // no matching arrivals
+	exitStale          = 4 // the feed is older than --feed-age-exit
+	exitFetchError     = 5 // the feed could not be fetched
+)
+
+// arrivalsOutcome classifies the result of an arrivals query
+type arrivalsOutcome int
+
+// Outcomes in order of precedence: when several apply, the first one wins
+const (
+	outcomeFetchError arrivalsOutcome = iota
+	outcomeStale
+	outcomeUnknownStation
+	outcomeEmpty
+	outcomeArrivals
+)
+
+// mappedExitCodes are the exit statuses used with --exit-code-map
+var mappedExitCodes = map[arrivalsOutcome]int{
+	outcomeFetchError:     exitFetchError,
+	outcomeStale:          exitStale,
+	outcomeUnknownStation: exitUnknownStation,
+	outcomeEmpty:          exitEmpty,
+	outcomeArrivals:       exitOK,
+}
+
+// ExitError is returned by a command that has already reported its
+// outcome and only needs Execute to exit with Code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// exitWith returns an *ExitError for a non-zero code, or nil
+func exitWith(code int) error {
+	if code == exitOK {
+		return nil
+	}
+	return &ExitError{Code: code}
+}
+
+// exitCode maps the outcome of an arrivals query with count matching
+// arrivals to the exit status selected by the flags
+func exitCode(outcome arrivalsOutcome, count int) int {
+	if exitCodeMap {
+		return mappedExitCodes[outcome]
+	}
+	switch {
+	case outcome == outcomeFetchError && (jsonOutput || jsonMeta || feedAgeExit > 0):
+		return exitError
+	case outcome == outcomeStale:
+		return exitStale
+	case outcome == outcomeUnknownStation && strictMode:
+		return exitUnknownStation
+	case count == 0 && failOnEmpty:
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	type flags struct {
+		exitCodeMap, json, strict, failOnEmpty, feedAge bool
+	}
+	tests := []struct {
+		name    string
+		flags   flags
+		outcome arrivalsOutcome
+		count   int
+		want    int
+	}{
+		{name: "arrivals", outcome: outcomeArrivals, count: 3, want: exitOK},
+		{name: "empty", outcome: outcomeEmpty, want: exitOK},
+		{name: "empty, fail on empty", flags: flags{failOnEmpty: true}, outcome: outcomeEmpty, want: exitError},
+		{name: "unknown station", outcome: outcomeUnknownStation, want: exitOK},
+		{name: "unknown station, strict", flags: flags{strict: true}, outcome: outcomeUnknownStation, want: exitUnknownStation},
+		{name: "fetch error", outcome: outcomeFetchError, want: exitOK},
+		{name: "fetch error, json", flags: flags{json: true}, outcome: outcomeFetchError, want: exitError},
+		{name: "fetch error, feed age", flags: flags{feedAge: true}, outcome: outcomeFetchError, want: exitError},
+		{name: "stale", flags: flags{feedAge: true}, outcome: outcomeStale, count: 3, want: exitStale},
+
+		{name: "mapped arrivals", flags: flags{exitCodeMap: true}, outcome: outcomeArrivals, count: 3, want: exitOK},
+		{name: "mapped empty", flags: flags{exitCodeMap: true}, outcome: outcomeEmpty, want: exitEmpty},
+		{name: "mapped unknown station", flags: flags{exitCodeMap: true}, outcome: outcomeUnknownStation, want: exitUnknownStation},
+		{name: "mapped stale", flags: flags{exitCodeMap: true, feedAge: true}, outcome: outcomeStale, count: 3, want: exitStale},
+		{name: "mapped fetch error", flags: flags{exitCodeMap: true}, outcome: outcomeFetchError, want: exitFetchError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setGlobal(t, &exitCodeMap, tt.flags.exitCodeMap)
+			setGlobal(t, &jsonOutput, tt.flags.json)
+			setGlobal(t, &strictMode, tt.flags.strict)
+			setGlobal(t, &failOnEmpty, tt.flags.failOnEmpty)
+			feedAge := time.Duration(0)
+			if tt.flags.feedAge {
+				feedAge = 2 * time.Minute
+			}
+			setGlobal(t, &feedAgeExit, feedAge)
+
+			if got := exitCode(tt.outcome, tt.count); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrivalsExitStatus(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeedServer(t, server)
+	now := "--now=" + fixtureTime.Format(time.RFC3339)
+
+	// Without --exit-code-map, a script can still tell the two apart
+	stale, _, _ := runArrivals(t, "116N", "--feed-age-exit=1s", now)
+	if stale != exitStale {
+		t.Errorf("stale feed exit status = %d, want %d", stale, exitStale)
+	}
+	unknown, _, _ := runArrivals(t, "Nowhere St", "--strict", now)
+	if unknown != exitUnknownStation {
+		t.Errorf("unknown station exit status = %d, want %d", unknown, exitUnknownStation)
+	}
+}
+
+func TestArrivalsFeedAgeFetchError(t *testing.T) {
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	useFeedServer(t, server)
+
+	// A feed that can't be fetched has no age, so the fetch error decides
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{args: []string{"--feed-age-exit=2m"}, want: exitError},
+		{args: []string{"--feed-age-exit=2m", "--exit-code-map"}, want: exitFetchError},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runArrivals(t, append([]string{"116N", "--routes=1"}, tt.args...)...)
+		if code != tt.want {
+			t.Errorf("%v: exit status = %d, want %d", tt.args, code, tt.want)
+		}
+		if strings.Contains(stderr, "stale") {
+			t.Errorf("%v: a failed fetch was reported as stale: %q", tt.args, stderr)
+		}
+	}
+}
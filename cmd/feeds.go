@@ -0,0 +1,699 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// feedBaseURL is the common prefix of the MTA GTFS-Realtime endpoints
+const feedBaseURL = "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/"
+
+// Feed describes a GTFS-Realtime endpoint and the routes it serves
+type Feed struct {
+	Name   string
+	URL    string
+	Routes []string
+	// Headers are sent with every request for the feed, e.g. an API key
+	Headers map[string]string
+}
+
+// feeds is the registry of NYCT subway and Staten Island Railway feeds
+var feeds = []Feed{
+	// A Division (1, 2, 3, 4, 5, 6, 7 and the 42 St Shuttle)
+	{Name: "1234567S", URL: feedBaseURL + "nyct%2Fgtfs", Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}},
+	// B Division, including the Franklin Av (FS) and Rockaway Park (H) shuttles
+	{Name: "ACE", URL: feedBaseURL + "nyct%2Fgtfs-ace", Routes: []string{"A", "C", "E", "FS", "H"}},
+	{Name: "BDFM", URL: feedBaseURL + "nyct%2Fgtfs-bdfm", Routes: []string{"B", "D", "F", "M"}},
+	{Name: "G", URL: feedBaseURL + "nyct%2Fgtfs-g", Routes: []string{"G"}},
+	{Name: "JZ", URL: feedBaseURL + "nyct%2Fgtfs-jz", Routes: []string{"J", "Z"}},
+	{Name: "NQRW", URL: feedBaseURL + "nyct%2Fgtfs-nqrw", Routes: []string{"N", "Q", "R", "W"}},
+	{Name: "L", URL: feedBaseURL + "nyct%2Fgtfs-l", Routes: []string{"L"}},
+	// Staten Island Railway
+	{Name: "SI", URL: feedBaseURL + "nyct%2Fgtfs-si", Routes: []string{"SI"}},
+}
+
+// routeAliases maps common names for routes to their GTFS route IDs
+var routeAliases = map[string]string{
+	"S":   "GS",
+	"SIR": "SI",
+}
+
+// routeGroups maps the names of common line bundles to their routes.
+// Groups are matched case-insensitively and may be mixed with routes.
+var routeGroups = map[string][]string{
+	"numbered": {"1", "2", "3", "4", "5", "6", "7"},
+	"lettered": {"A", "C", "E", "B", "D", "F", "M", "G", "J", "Z", "L", "N", "Q", "R", "W"},
+	"reds":     {"1", "2", "3"},
+	"greens":   {"4", "5", "6"},
+	"blues":    {"A", "C", "E"},
+	"oranges":  {"B", "D", "F", "M"},
+	"browns":   {"J", "Z"},
+	"yellows":  {"N", "Q", "R", "W"},
+}
+
+// expandRouteGroups replaces route group names with their routes, keeping
+// the order given and dropping routes named more than once
+func expandRouteGroups(routes []string) []string {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(route string) {
+		if key := normalizeRoute(route); !seen[key] {
+			seen[key] = true
+			expanded = append(expanded, route)
+		}
+	}
+	for _, route := range routes {
+		if group, ok := routeGroups[strings.ToLower(strings.TrimSpace(route))]; ok {
+			for _, member := range group {
+				add(member)
+			}
+			continue
+		}
+		add(route)
+	}
+	return expanded
+}
+
+// normalizeRoute converts a user-supplied route name to its GTFS route ID
+func normalizeRoute(route string) string {
+	route = strings.ToUpper(strings.TrimSpace(route))
+	if alias, ok := routeAliases[route]; ok {
+		return alias
+	}
+	return route
+}
+
+// baseRoute strips the express suffix from a feed route ID, so that
+// diamond express trains such as 6X and 7X count as the 6 and 7
+func baseRoute(routeID string) string {
+	if len(routeID) == 2 && strings.HasSuffix(routeID, "X") {
+		return strings.TrimSuffix(routeID, "X")
+	}
+	return routeID
+}
+
+// routeSet converts user-supplied route names to a set of GTFS route IDs
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		set[normalizeRoute(route)] = true
+	}
+	return set
+}
+
+// UnknownRouteError is returned for a route that no registered feed serves
+type UnknownRouteError struct {
+	Route string
+	// Suggestions are similar routes and route groups, if any
+	Suggestions []string
+}
+
+func (e *UnknownRouteError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return fmt.Sprintf("unknown route: %s; did you mean: %s?", e.Route, strings.Join(e.Suggestions, ", "))
+	}
+	return fmt.Sprintf("unknown route: %s", e.Route)
+}
+
+// suggestRoutes returns up to maxSuggestions known routes and route groups
+// close to an unknown route. Route IDs are too short for edit distance to
+// tell them apart, so a route is suggested when it starts the unknown one
+// followed by one more character, e.g. 6 for 6X, or when the unknown one
+// starts it. Group names are matched by prefix or edit distance.
+func suggestRoutes(route string) []string {
+	var suggestions []string
+	seen := make(map[string]bool)
+	for _, feed := range feeds {
+		for _, known := range feed.Routes {
+			if !seen[known] && (strings.HasPrefix(route, known) && len(route)-len(known) <= 1 || strings.HasPrefix(known, route)) {
+				seen[known] = true
+				suggestions = append(suggestions, known)
+			}
+		}
+	}
+
+	lower := strings.ToLower(route)
+	threshold := max(len(lower)/2, 1)
+	var groups []string
+	for name := range routeGroups {
+		if strings.HasPrefix(name, lower) || levenshtein(lower, name) <= threshold {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	suggestions = append(suggestions, groups...)
+	return suggestions[:min(len(suggestions), maxSuggestions)]
+}
+
+// feedsForRoutes returns the fewest feeds needed to cover the given
+// routes. A route can be served by several feeds when custom feeds overlap;
+// each time, the feed serving the most of the routes still uncovered is
+// picked, so no endpoint is fetched for routes another one already covers.
+func feedsForRoutes(routes []string) ([]Feed, error) {
+	needed := make(map[string]bool)
+	for _, route := range routes {
+		route = normalizeRoute(route)
+		found := false
+		for _, feed := range feeds {
+			if slices.Contains(feed.Routes, route) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, &UnknownRouteError{Route: route, Suggestions: suggestRoutes(route)}
+		}
+		needed[route] = true
+	}
+
+	var selected []Feed
+	for len(needed) > 0 {
+		// Ties go to the feed registered first
+		best, covered := 0, 0
+		for i, feed := range feeds {
+			count := 0
+			for _, route := range feed.Routes {
+				if needed[route] {
+					count++
+				}
+			}
+			if count > covered {
+				best, covered = i, count
+			}
+		}
+		selected = append(selected, feeds[best])
+		for _, route := range feeds[best].Routes {
+			delete(needed, route)
+		}
+	}
+
+	// Keep a stable order regardless of how routes were specified
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Name < selected[j].Name
+	})
+
+	return selected, nil
+}
+
+// defaultFeed is the feed fetched when no routes are requested
+var defaultFeed = feeds[0]
+
+// ArrivalsOptions configures an Arrivals query
+type ArrivalsOptions struct {
+	// Routes to fetch, e.g. "1" or "A". Defaults to every route in the
+	// A Division feed (1-7 and the 42 St Shuttle).
+	Routes []string
+	// Now is the reference instant; earlier arrivals are dropped.
+	// Defaults to time.Now().
+	Now time.Time
+	// Filter, if set, keeps only the arrivals for which it returns true
+	Filter func(Arrival) bool
+	// Client is the HTTP client used to fetch the feeds.
+	// Defaults to a client with a 30 second timeout.
+	Client *http.Client
+	// FeedClient, if set, is used instead of Client. Reusing one across
+	// queries avoids downloading feeds that have not changed since.
+	FeedClient *FeedClient
+	// Departures selects departure events instead of arrivals. Stops a
+	// trip only arrives at, i.e. where it ends, are left out.
+	Departures bool
+	// EndpointTimeout, if positive, limits how long each feed may take.
+	// A feed that takes longer is left out and listed in Snapshot.TimedOut,
+	// unless every feed did.
+	EndpointTimeout time.Duration
+}
+
+// Snapshot is the result of fetching the feeds for an Arrivals query
+type Snapshot struct {
+	Arrivals []Arrival
+	// Timestamp is the oldest header timestamp of the fetched feeds, i.e.
+	// how fresh the stalest data is. It is zero if no feed reported one.
+	Timestamp time.Time
+	// Stats has the timings of each fetched feed
+	Stats []FeedStats
+	// Rerouted lists the routes with trips on a detour, for feeds that
+	// publish trip modifications
+	Rerouted []string
+	// TimedOut lists the feeds left out for exceeding EndpointTimeout
+	TimedOut []string
+}
+
+// FeedStats describes how long fetching a single feed took
+type FeedStats struct {
+	Feed     string
+	Entities int
+	// RoundTrip covers the HTTP request and reading the body
+	RoundTrip time.Duration
+	// Parse covers unmarshaling the protobuf message
+	Parse time.Duration
+	// NotModified is set when the cached feed was reused
+	NotModified bool
+}
+
+// Total returns the total time spent fetching the feed
+func (s FeedStats) Total() time.Duration {
+	return s.RoundTrip + s.Parse
+}
+
+// FetchTime returns the total time spent fetching every feed
+func (s *Snapshot) FetchTime() time.Duration {
+	var total time.Duration
+	for _, stats := range s.Stats {
+		total += stats.Total()
+	}
+	return total
+}
+
+// Arrivals fetches the upcoming arrivals for the requested routes from the
+// MTA GTFS-Realtime feeds. Only the feeds serving those routes are fetched.
+func Arrivals(ctx context.Context, opts ArrivalsOptions) ([]Arrival, error) {
+	snapshot, err := FetchSnapshot(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Arrivals, nil
+}
+
+// FetchSnapshot is like Arrivals, but also reports the feed timestamp
+func FetchSnapshot(ctx context.Context, opts ArrivalsOptions) (*Snapshot, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	client := opts.FeedClient
+	if client == nil {
+		client = NewFeedClient(opts.Client)
+	}
+
+	snapshot, err := fetchArrivals(ctx, client, opts.Routes, now, opts.Departures, opts.EndpointTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Filter == nil {
+		return snapshot, nil
+	}
+	var filtered []Arrival
+	for _, arrival := range snapshot.Arrivals {
+		if opts.Filter(arrival) {
+			filtered = append(filtered, arrival)
+		}
+	}
+	snapshot.Arrivals = filtered
+	return snapshot, nil
+}
+
+// fetchArrivals fetches every feed needed for the given routes and
+// returns the combined arrivals (or departures) for those routes after now.
+// With no routes, it returns every route in the default feed. The feeds
+// are fetched concurrently, each within endpointTimeout if it is positive.
+func fetchArrivals(ctx context.Context, client *FeedClient, routes []string, now time.Time, departures bool, endpointTimeout time.Duration) (*Snapshot, error) {
+	selected := []Feed{defaultFeed}
+	var wanted map[string]bool
+	if len(routes) > 0 {
+		var err error
+		selected, err = feedsForRoutes(routes)
+		if err != nil {
+			return nil, err
+		}
+
+		wanted = routeSet(routes)
+	}
+
+	type result struct {
+		message *gtfs.FeedMessage
+		stats   FeedStats
+		err     error
+	}
+	results := make([]result, len(selected))
+	var wg sync.WaitGroup
+	for i, feed := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			feedCtx := ctx
+			if endpointTimeout > 0 {
+				var cancel context.CancelFunc
+				feedCtx, cancel = context.WithTimeout(ctx, endpointTimeout)
+				defer cancel()
+			}
+			results[i].message, results[i].stats, results[i].err = client.fetch(feedCtx, feed)
+		}()
+	}
+	wg.Wait()
+
+	// Merge in feed order, so the result doesn't depend on which feed
+	// answered first
+	snapshot := &Snapshot{}
+	seen := make(map[string]bool)
+	for i, feed := range selected {
+		message, stats, err := results[i].message, results[i].stats, results[i].err
+		if err != nil {
+			// Only the feed's own deadline makes it skippable, not the caller's
+			if endpointTimeout > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				snapshot.TimedOut = append(snapshot.TimedOut, feed.Name)
+				continue
+			}
+			return nil, fmt.Errorf("%s feed: %w", feed.Name, err)
+		}
+		stats.Feed = feed.Name
+		snapshot.Stats = append(snapshot.Stats, stats)
+		snapshot.Arrivals = mergeArrivals(snapshot.Arrivals, parseArrivals(message, wanted, now, departures), seen)
+		snapshot.Rerouted = append(snapshot.Rerouted, reroutedRoutes(message, wanted)...)
+
+		// Keep the oldest timestamp, so one stale feed is not hidden by fresh ones
+		if timestamp := feedTimestamp(message); !timestamp.IsZero() {
+			if snapshot.Timestamp.IsZero() || timestamp.Before(snapshot.Timestamp) {
+				snapshot.Timestamp = timestamp
+			}
+		}
+	}
+
+	if len(snapshot.TimedOut) == len(selected) {
+		return nil, fmt.Errorf("no feed answered within %s", endpointTimeout)
+	}
+	return snapshot, nil
+}
+
+// mergeArrivals appends the arrivals from another feed, skipping those
+// already present. A trip serving a stop shared by two feeds can appear in
+// both; it is the same prediction, so it must only be counted once.
+// seen tracks the keys merged so far and is updated in place.
+func mergeArrivals(merged, batch []Arrival, seen map[string]bool) []Arrival {
+	for _, arrival := range batch {
+		key := fmt.Sprintf("%s|%s|%d", arrival.TripID, arrival.StopID, arrival.Arrival.Unix())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, arrival)
+	}
+	return merged
+}
+
+// feedTimestamp returns the time the feed was generated, or the zero time
+// if the header does not say
+func feedTimestamp(feed *gtfs.FeedMessage) time.Time {
+	timestamp := feed.GetHeader().GetTimestamp()
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(timestamp), 0)
+}
+
+// FeedClient fetches GTFS-Realtime feeds. It remembers the ETag and
+// Last-Modified validators of each feed and sends conditional requests, so a
+// feed that has not changed since the last fetch is not downloaded again.
+// It is safe for concurrent use.
+type FeedClient struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedFeed
+}
+
+// cachedFeed is the last feed message fetched from a URL, with its validators
+type cachedFeed struct {
+	etag         string
+	lastModified string
+	message      *gtfs.FeedMessage
+}
+
+// NewFeedClient returns a FeedClient using the given HTTP client, or a
+// client with a 30 second timeout if it is nil
+func NewFeedClient(client *http.Client) *FeedClient {
+	if client == nil {
+		client = newHTTPClient(false)
+	}
+	return &FeedClient{client: client, cache: make(map[string]cachedFeed)}
+}
+
+// newHTTPClient returns an HTTP client with a 30 second timeout. With
+// disableKeepAlives, every request opens a new connection, for proxies that
+// mishandle persistent ones.
+func newHTTPClient(disableKeepAlives bool) *http.Client {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if disableKeepAlives {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DisableKeepAlives = true
+		client.Transport = transport
+	}
+	return client
+}
+
+// fetchFeedMessage fetches a GTFS-Realtime feed once, without caching
+func fetchFeedMessage(ctx context.Context, client *http.Client, feed Feed) (*gtfs.FeedMessage, error) {
+	message, _, err := NewFeedClient(client).fetch(ctx, feed)
+	return message, err
+}
+
+// Fetch fetches a GTFS-Realtime feed and unmarshals the protobuf message.
+// If the feed has not changed since the previous fetch, the previous
+// message is returned. Callers must not modify the returned message.
+func (c *FeedClient) Fetch(ctx context.Context, url string) (*gtfs.FeedMessage, error) {
+	message, _, err := c.fetch(ctx, Feed{URL: url})
+	return message, err
+}
+
+// fetch is Fetch for a registry feed, sending its headers and also
+// reporting how long each step took
+func (c *FeedClient) fetch(ctx context.Context, source Feed) (*gtfs.FeedMessage, FeedStats, error) {
+	var stats FeedStats
+	start := time.Now()
+	url := source.URL
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Negotiate compression explicitly so gzip bodies are handled the same way
+	// whether they come from the endpoint or from a proxy in between
+	req.Header.Set("Accept-Encoding", "gzip")
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+
+	// Ask the endpoint to skip the body if the feed hasn't changed
+	c.mu.Lock()
+	cached, haveCached := c.cache[url]
+	c.mu.Unlock()
+	if haveCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	// Execute request
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		stats.RoundTrip = time.Since(start)
+		stats.Entities = len(cached.message.GetEntity())
+		stats.NotModified = true
+		return cached.message, stats, nil
+	}
+	if err := statusError(resp); err != nil {
+		return nil, stats, err
+	}
+
+	// Read the response body
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.RoundTrip = time.Since(start)
+
+	// Parse protobuf
+	parseStart := time.Now()
+	feed := &gtfs.FeedMessage{}
+	if err := proto.Unmarshal(data, feed); err != nil {
+		return nil, stats, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	stats.Parse = time.Since(parseStart)
+	stats.Entities = len(feed.GetEntity())
+
+	// Remember the validators for the next fetch
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		c.mu.Lock()
+		c.cache[url] = cachedFeed{etag: etag, lastModified: lastModified, message: feed}
+		c.mu.Unlock()
+	}
+
+	return feed, stats, nil
+}
+
+// parseArrivals extracts the arrivals for the given routes (all routes if nil)
+// from a feed message, dropping arrivals before now. With departures, the
+// departure events are extracted instead.
+func parseArrivals(feed *gtfs.FeedMessage, routes map[string]bool, now time.Time, departures bool) []Arrival {
+	// Extract arrivals for the requested routes
+	var arrivals []Arrival
+
+	for _, entity := range feed.GetEntity() {
+		tripUpdate := entity.GetTripUpdate()
+		if tripUpdate == nil {
+			continue
+		}
+
+		trip := tripUpdate.GetTrip()
+		if trip == nil {
+			continue
+		}
+
+		routeID := baseRoute(trip.GetRouteId())
+		if routes != nil && !routes[normalizeRoute(routeID)] {
+			continue
+		}
+
+		// The last stop with a prediction is where the trip is headed
+		var destination string
+		if updates := tripUpdate.GetStopTimeUpdate(); len(updates) > 0 {
+			destination = updates[len(updates)-1].GetStopId()
+		}
+
+		trainID := nyctTrainID(trip)
+		var updated time.Time
+		if timestamp := tripUpdate.GetTimestamp(); timestamp != 0 {
+			updated = time.Unix(int64(timestamp), 0)
+		}
+
+		// Process stop time updates. Each is a stop the train has yet to
+		// make, in order, so the ones kept so far are the stops before it.
+		stopsAway := 0
+		for _, stopTimeUpdate := range tripUpdate.GetStopTimeUpdate() {
+			// At terminals there is often only a departure event,
+			// so fall back to it when the arrival is missing. Departures
+			// have no fallback: a train without one ends its run there.
+			fromDeparture := departures
+			arrivalEvent := stopTimeUpdate.GetArrival()
+			if departures {
+				arrivalEvent = stopTimeUpdate.GetDeparture()
+			} else if arrivalEvent.GetTime() == 0 && stopTimeUpdate.GetDeparture().GetTime() != 0 {
+				arrivalEvent = stopTimeUpdate.GetDeparture()
+				fromDeparture = true
+			}
+
+			arrivalTime := arrivalEvent.GetTime()
+			if arrivalTime == 0 {
+				continue
+			}
+
+			// Convert Unix timestamp to time.Time
+			t := time.Unix(arrivalTime, 0)
+
+			// Filter out past arrivals
+			if t.Before(now) {
+				continue
+			}
+
+			stopID := stopTimeUpdate.GetStopId()
+			if stopID == "" {
+				continue
+			}
+
+			scheduledTrack, actualTrack := nyctTracks(stopTimeUpdate)
+			arrivals = append(arrivals, Arrival{
+				StopID:         stopID,
+				RouteID:        routeID,
+				TripID:         trip.GetTripId(),
+				StartDate:      trip.GetStartDate(),
+				StartTime:      trip.GetStartTime(),
+				Arrival:        t,
+				FromDeparture:  fromDeparture,
+				Destination:    destination,
+				Delay:          time.Duration(arrivalEvent.GetDelay()) * time.Second,
+				TrainID:        trainID,
+				ScheduledTrack: scheduledTrack,
+				ActualTrack:    actualTrack,
+				Updated:        updated,
+				StopsAway:      stopsAway,
+			})
+			stopsAway++
+		}
+	}
+
+	return arrivals
+}
+
+// RateLimitError is returned when the feed endpoint responds with 429 Too Many Requests
+type RateLimitError struct {
+	// RetryAfter is how long the endpoint asked us to wait, or 0 if it did not say
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited, try again in %s", e.RetryAfter)
+	}
+	return "rate limited, try again later"
+}
+
+// statusError converts a non-200 response into an error with actionable messaging
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("access denied (status %d): check your API key", resp.StatusCode)
+	case http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either as a number of
+// seconds or as an HTTP date. Returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now).Round(time.Second)
+	}
+	return 0
+}
+
+// readBody reads the response body, decompressing it if it is gzip-encoded
+func readBody(resp *http.Response) ([]byte, error) {
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response body: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return data, nil
+}
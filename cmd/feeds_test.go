@@ -0,0 +1,523 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// stopUpdate is a predicted arrival of a trip at a stop, for building feed
+// messages in tests
+type stopUpdate struct {
+	tripID, routeID, stopID string
+	arrival                 time.Time
+}
+
+// feedMessage builds a feed message with one trip update per stop update
+func feedMessage(t *testing.T, timestamp time.Time, updates ...stopUpdate) []byte {
+	t.Helper()
+	message := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(uint64(timestamp.Unix())),
+		},
+	}
+	for i, update := range updates {
+		message.Entity = append(message.Entity, &gtfs.FeedEntity{
+			Id: proto.String(strconv.Itoa(i + 1)),
+			TripUpdate: &gtfs.TripUpdate{
+				Trip: &gtfs.TripDescriptor{TripId: proto.String(update.tripID), RouteId: proto.String(update.routeID)},
+				StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{{
+					StopId:  proto.String(update.stopID),
+					Arrival: &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(update.arrival.Unix())},
+				}},
+			},
+		})
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFetchSnapshotSharedStops(t *testing.T) {
+	now := time.Date(2026, 10, 16, 15, 0, 0, 0, time.UTC)
+
+	// Both endpoints report the same train at a stop they share
+	shared := stopUpdate{tripID: "098200_1..S03R", routeID: "1", stopID: "127S", arrival: now.Add(4 * time.Minute)}
+	first := feedMessage(t, now,
+		shared,
+		stopUpdate{tripID: "098500_1..S03R", routeID: "1", stopID: "127S", arrival: now.Add(9 * time.Minute)},
+	)
+	second := feedMessage(t, now.Add(-30*time.Second),
+		shared,
+		// The same trip at another time is a different prediction
+		stopUpdate{tripID: "098200_1..S03R", routeID: "1", stopID: "127S", arrival: now.Add(5 * time.Minute)},
+		stopUpdate{tripID: "097900_2..S08R", routeID: "2", stopID: "127S", arrival: now.Add(6 * time.Minute)},
+	)
+	serve := func(data []byte) *feedServer {
+		return newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+	}
+	firstServer, secondServer := serve(first), serve(second)
+	useFeeds(t, []Feed{
+		{Name: "first", URL: firstServer.URL, Routes: []string{"1"}},
+		{Name: "second", URL: secondServer.URL, Routes: []string{"2"}},
+	})
+
+	snapshot, err := FetchSnapshot(context.Background(), ArrivalsOptions{Routes: []string{"1", "2"}, Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, arrival := range snapshot.Arrivals {
+		got = append(got, arrival.TripID+"@"+arrival.Arrival.Sub(now).String())
+	}
+	want := []string{"098200_1..S03R@4m0s", "098500_1..S03R@9m0s", "098200_1..S03R@5m0s", "097900_2..S08R@6m0s"}
+	if !slices.Equal(got, want) {
+		t.Errorf("arrivals = %v, want %v", got, want)
+	}
+	if !snapshot.Timestamp.Equal(now.Add(-30 * time.Second)) {
+		t.Errorf("timestamp = %v, want the older feed's", snapshot.Timestamp)
+	}
+}
+
+func TestParseArrivals(t *testing.T) {
+	feed := loadFeedFixture(t, "gtfs.pb")
+
+	tests := []struct {
+		name       string
+		routes     []string
+		now        time.Time
+		departures bool
+		want       []string // stop IDs, in feed order
+	}{
+		{
+			name: "all routes",
+			now:  fixtureTime,
+			want: []string{"120N", "117N", "116N", "101N", "116S", "117S", "120S", "120S", "127S", "626N", "625N", "101S", "116S"},
+		},
+		{
+			name:   "one route",
+			routes: []string{"1"},
+			now:    fixtureTime,
+			want:   []string{"120N", "117N", "116N", "101N", "116S", "117S", "120S", "101S", "116S"},
+		},
+		{
+			name:   "express counts as its route",
+			routes: []string{"6"},
+			now:    fixtureTime,
+			want:   []string{"626N", "625N"},
+		},
+		{
+			name:       "departures",
+			routes:     []string{"1"},
+			now:        fixtureTime,
+			departures: true,
+			want:       []string{"120N", "117N", "116N", "116S", "117S", "120S", "101S", "116S"},
+		},
+		{
+			name: "later now drops past arrivals",
+			now:  fixtureTime.Add(10 * time.Minute),
+			want: []string{"101N", "127S", "101S", "116S"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var routes map[string]bool
+			if tt.routes != nil {
+				routes = routeSet(tt.routes)
+			}
+			var got []string
+			for _, arrival := range parseArrivals(feed, routes, tt.now, tt.departures) {
+				got = append(got, arrival.StopID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArrivalsFields(t *testing.T) {
+	feed := loadFeedFixture(t, "gtfs.pb")
+	arrivals := parseArrivals(feed, nil, fixtureTime, false)
+
+	find := func(tripID, stopID string) Arrival {
+		t.Helper()
+		for _, arrival := range arrivals {
+			if arrival.TripID == tripID && arrival.StopID == stopID {
+				return arrival
+			}
+		}
+		t.Fatalf("no arrival of trip %s at %s", tripID, stopID)
+		return Arrival{}
+	}
+
+	got := find("098200_1..S03R", "117S")
+	want := Arrival{
+		StopID:      "117S",
+		RouteID:     "1",
+		TripID:      "098200_1..S03R",
+		StartDate:   "20261016",
+		StartTime:   "14:43:00",
+		Arrival:     fixtureTime.Add(3 * time.Minute),
+		Destination: "120S",
+		Delay:       time.Minute,
+		Updated:     fixtureTime.Add(-20 * time.Second),
+		StopsAway:   1,
+	}
+	if !got.Arrival.Equal(want.Arrival) || !got.Updated.Equal(want.Updated) {
+		t.Errorf("times = %v, %v, want %v, %v", got.Arrival, got.Updated, want.Arrival, want.Updated)
+	}
+	got.Arrival, got.Updated = want.Arrival, want.Updated
+	if got != want {
+		t.Errorf("arrival = %+v, want %+v", got, want)
+	}
+
+	// A terminal with only a departure time falls back to it
+	if terminal := find("099000_1..S03R", "101S"); !terminal.FromDeparture {
+		t.Errorf("101S FromDeparture = false, want true")
+	}
+	if express := find("098000_6..N", "626N"); express.RouteID != "6" {
+		t.Errorf("6X RouteID = %q, want 6", express.RouteID)
+	}
+}
+
+func TestNormalizeRoute(t *testing.T) {
+	tests := []struct {
+		route, want string
+	}{
+		{route: "1", want: "1"},
+		{route: " a ", want: "A"},
+		{route: "SI", want: "SI"},
+		{route: "SIR", want: "SI"},
+		{route: "sir", want: "SI"},
+		{route: "GS", want: "GS"},
+		{route: "S", want: "GS"},
+		{route: "s", want: "GS"},
+		{route: "FS", want: "FS"},
+		{route: "fs", want: "FS"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRoute(tt.route); got != tt.want {
+			t.Errorf("normalizeRoute(%q) = %q, want %q", tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestFeedsForRoutes(t *testing.T) {
+	tests := []struct {
+		routes  []string
+		want    []string // feed names
+		wantErr string
+	}{
+		{routes: []string{"1"}, want: []string{"1234567S"}},
+		{routes: []string{"1", "6", "GS"}, want: []string{"1234567S"}},
+		{routes: []string{"s"}, want: []string{"1234567S"}},
+		{routes: []string{"L", "1"}, want: []string{"1234567S", "L"}},
+		{routes: []string{"A", "Q", "SIR"}, want: []string{"ACE", "NQRW", "SI"}},
+		{routes: []string{"SI"}, want: []string{"SI"}},
+		{routes: []string{"sir"}, want: []string{"SI"}},
+		{routes: []string{"GS"}, want: []string{"1234567S"}},
+		{routes: []string{"S"}, want: []string{"1234567S"}},
+		{routes: []string{"FS"}, want: []string{"ACE"}},
+		{routes: []string{"fs", "H"}, want: []string{"ACE"}},
+		{routes: []string{"1", "9"}, wantErr: "unknown route: 9"},
+	}
+	for _, tt := range tests {
+		got, err := feedsForRoutes(tt.routes)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("feedsForRoutes(%v) error = %v, want %q", tt.routes, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("feedsForRoutes(%v) error = %v", tt.routes, err)
+			continue
+		}
+		var names []string
+		for _, feed := range got {
+			names = append(names, feed.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("feedsForRoutes(%v) = %v, want %v", tt.routes, names, tt.want)
+		}
+	}
+}
+
+func TestFeedClientFetch(t *testing.T) {
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write(readFixture(t, "gtfs.pb"))
+	})
+
+	client := NewFeedClient(server.Client())
+	message, stats, err := client.fetch(context.Background(), Feed{Name: "test", URL: server.URL, Headers: map[string]string{"X-Api-Key": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(message.GetEntity()); got != 6 || stats.Entities != 6 {
+		t.Errorf("entities = %d (stats %d), want 6", got, stats.Entities)
+	}
+	if got := feedTimestamp(message); !got.Equal(fixtureTime.Add(-15 * time.Second)) {
+		t.Errorf("timestamp = %v, want 15s before %v", got, fixtureTime)
+	}
+
+	// Without the header the endpoint refuses the request
+	if _, err := client.Fetch(context.Background(), server.URL); err == nil {
+		t.Error("Fetch without the API key succeeded, want an error")
+	}
+}
+
+func TestFeedClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(error) bool
+	}{
+		{
+			name: "rate limited",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "20")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			check: func(err error) bool {
+				var limited *RateLimitError
+				return errors.As(err, &limited) && limited.RetryAfter == 20*time.Second
+			},
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			check: func(err error) bool { return err != nil && err.Error() == "unexpected status code: 502" },
+		},
+		{
+			name: "not protobuf",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("<html>maintenance</html>"))
+			},
+			check: func(err error) bool { return err != nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFeedServer(t, tt.handler)
+			_, err := NewFeedClient(server.Client()).Fetch(context.Background(), server.URL)
+			if !tt.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchSnapshot(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeeds(t, []Feed{{Name: "1234567S", URL: server.URL, Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}}})
+
+	snapshot, err := FetchSnapshot(context.Background(), ArrivalsOptions{
+		Routes:     []string{"2"},
+		Now:        fixtureTime,
+		FeedClient: NewFeedClient(server.Client()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(snapshot.Arrivals); got != 2 {
+		t.Errorf("arrivals = %d, want 2", got)
+	}
+	if !snapshot.Timestamp.Equal(fixtureTime.Add(-15 * time.Second)) {
+		t.Errorf("timestamp = %v", snapshot.Timestamp)
+	}
+}
+
+func TestFeedClientGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(readFixture(t, "gtfs.pb"))
+	gz.Close()
+
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr bool
+	}{
+		{name: "gzip body", body: compressed.Bytes()},
+		{name: "corrupt gzip body", body: compressed.Bytes()[:20], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(tt.body)
+			})
+
+			message, err := NewFeedClient(server.Client()).Fetch(context.Background(), server.URL)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Fetch succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(message.GetEntity()); got != 6 {
+				t.Errorf("entities = %d, want 6", got)
+			}
+		})
+	}
+}
+
+func TestFeedClientConditional(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Fri, 16 Oct 2026 18:59:45 GMT"
+	fixture := readFixture(t, "gtfs.pb")
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write(fixture)
+	})
+
+	client := NewFeedClient(server.Client())
+	feed := Feed{Name: "test", URL: server.URL}
+	first, stats, err := client.fetch(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NotModified {
+		t.Error("first fetch NotModified = true, want false")
+	}
+
+	// The second fetch sends the validators and reuses the cached message
+	second, stats, err := client.fetch(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.NotModified || second != first {
+		t.Errorf("second fetch NotModified = %v, same message = %v, want both", stats.NotModified, second == first)
+	}
+	if stats.Entities != 6 {
+		t.Errorf("entities = %d, want 6", stats.Entities)
+	}
+
+	// A new client has nothing cached, so it downloads the feed
+	if _, stats, err := NewFeedClient(server.Client()).fetch(context.Background(), feed); err != nil || stats.NotModified {
+		t.Errorf("fetch with a new client: NotModified = %v, err = %v", stats.NotModified, err)
+	}
+	if n := server.requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestFetchSnapshotFeedCount(t *testing.T) {
+	tests := []struct {
+		routes []string
+		want   []string // feeds requested
+	}{
+		{routes: []string{"1"}, want: []string{"/1234567S"}},
+		{routes: []string{"1", "L"}, want: []string{"/1234567S", "/L"}},
+		{routes: []string{"1", "2", "6", "GS"}, want: []string{"/1234567S"}},
+		{routes: []string{"A", "C", "E", "1"}, want: []string{"/1234567S", "/ACE"}},
+		{routes: nil, want: []string{"/1234567S"}},
+	}
+	fixture := readFixture(t, "gtfs.pb")
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.routes, ","), func(t *testing.T) {
+			var mu sync.Mutex
+			var paths []string
+			server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				paths = append(paths, r.URL.Path)
+				mu.Unlock()
+				w.Write(fixture)
+			})
+			useFeedServer(t, server)
+
+			_, err := FetchSnapshot(context.Background(), ArrivalsOptions{
+				Routes:     tt.routes,
+				Now:        fixtureTime,
+				FeedClient: NewFeedClient(server.Client()),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(paths)
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(paths, want) {
+				t.Errorf("requested %v, want %v", paths, want)
+			}
+		})
+	}
+}
+
+func TestFetchSnapshotEndpointTimeout(t *testing.T) {
+	fixture := readFixture(t, "gtfs.pb")
+	slow := make(chan struct{})
+	t.Cleanup(func() { close(slow) })
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// The L feed lags behind the others
+		if r.URL.Path == "/L" {
+			select {
+			case <-slow:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write(fixture)
+	})
+	useFeedServer(t, server)
+
+	options := ArrivalsOptions{
+		Routes:          []string{"1", "L"},
+		Now:             fixtureTime,
+		FeedClient:      NewFeedClient(server.Client()),
+		EndpointTimeout: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	snapshot, err := FetchSnapshot(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("fetch took %s, want it cut short by the endpoint timeout", elapsed)
+	}
+	if !slices.Equal(snapshot.TimedOut, []string{"L"}) {
+		t.Errorf("timed out feeds = %v, want [L]", snapshot.TimedOut)
+	}
+	if len(snapshot.Arrivals) == 0 {
+		t.Error("no arrivals from the feed that answered")
+	}
+
+	// With only the slow feed, there is nothing to show
+	options.Routes = []string{"L"}
+	if _, err := FetchSnapshot(context.Background(), options); err == nil || !strings.Contains(err.Error(), "no feed answered") {
+		t.Errorf("error = %v, want no feed answered", err)
+	}
+}
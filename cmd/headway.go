@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// headwayGap is an unusually long wait between consecutive trains of one
+// route at one stop
+type headwayGap struct {
+	RouteID string
+	StopID  string
+	// Next is the soonest train at the stop
+	Next time.Time
+	// Before is the train after which the gap starts, possibly Next
+	Before time.Time
+	Gap    time.Duration
+}
+
+// findHeadwayGaps returns the first gap longer than minHeadway for each
+// route and stop, ordered by route, then stop
+func findHeadwayGaps(arrivals []Arrival, minHeadway time.Duration) []headwayGap {
+	sortArrivals(arrivals)
+
+	// Bucket by route and stop; the stop ID carries the direction
+	buckets := make(map[string][]Arrival)
+	var keys []string
+	for _, arrival := range arrivals {
+		key := arrival.RouteID + "/" + arrival.StopID
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], arrival)
+	}
+
+	var gaps []headwayGap
+	for _, key := range keys {
+		bucket := buckets[key]
+		for i := 1; i < len(bucket); i++ {
+			if gap := bucket[i].Arrival.Sub(bucket[i-1].Arrival); gap > minHeadway {
+				gaps = append(gaps, headwayGap{
+					RouteID: bucket[0].RouteID,
+					StopID:  bucket[0].StopID,
+					Next:    bucket[0].Arrival,
+					Before:  bucket[i-1].Arrival,
+					Gap:     gap,
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].RouteID != gaps[j].RouteID {
+			return gaps[i].RouteID < gaps[j].RouteID
+		}
+		return gaps[i].StopID < gaps[j].StopID
+	})
+	return gaps
+}
+
+// directionName spells out the direction suffix of a stop ID
+func directionName(direction string) string {
+	switch direction {
+	case "N":
+		return "northbound"
+	case "S":
+		return "southbound"
+	}
+	return ""
+}
+
+// minutesUntil returns the whole minutes from now until t, never negative
+func minutesUntil(t, now time.Time) int {
+	if minutes := int(t.Sub(now).Minutes()); minutes > 0 {
+		return minutes
+	}
+	return 0
+}
+
+// printHeadwayGaps writes a warning line for each gap, e.g.
+// "Gap: next 1 northbound at 96 St in 4 min, then a gap of 18 min"
+func printHeadwayGaps(w io.Writer, gaps []headwayGap, stopIDToName map[string]string, now time.Time) {
+	if len(gaps) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	for _, gap := range gaps {
+		train := colorRoute(gap.RouteID)
+		if direction := directionName(stopDirection(gap.StopID)); direction != "" {
+			train += " " + direction
+		}
+		station, _ := lookupStationName(gap.StopID, stopIDToName)
+		gapMinutes := int(gap.Gap.Round(time.Minute).Minutes())
+		if gap.Before.Equal(gap.Next) {
+			fmt.Fprintf(w, "Gap: next %s at %s in %d min, then a gap of %d min\n",
+				train, station, minutesUntil(gap.Next, now), gapMinutes)
+		} else {
+			fmt.Fprintf(w, "Gap: next %s at %s in %d min, then a gap of %d min after the train in %d min\n",
+				train, station, minutesUntil(gap.Next, now), gapMinutes, minutesUntil(gap.Before, now))
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+)
+
+// update rewrites the golden files in testdata instead of comparing with them
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixtureTime is when testdata/gtfs.pb was generated, 3:00 PM in New York.
+// Its header timestamp is 15 seconds earlier.
+var fixtureTime = time.Unix(1792177200, 0)
+
+func TestMain(m *testing.M) {
+	// Clock times in the expected output are New York times
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		panic(err)
+	}
+	time.Local = loc
+	os.Exit(m.Run())
+}
+
+// readFixture returns the contents of a file in testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// loadFeedFixture unmarshals a feed message from testdata
+func loadFeedFixture(t *testing.T, name string) *gtfs.FeedMessage {
+	t.Helper()
+	feed := &gtfs.FeedMessage{}
+	if err := proto.Unmarshal(readFixture(t, name), feed); err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+// testIndex returns the stop index of testdata/stops.csv
+func testIndex(t *testing.T) StopIndex {
+	t.Helper()
+	stopIDToName, nameToIDs, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stops, err := LoadStops("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return StopIndex{StopIDToName: stopIDToName, NameToIDs: nameToIDs, Children: childStops(stops), Stops: stops}
+}
+
+// feedServer is an httptest server standing in for a feed endpoint. It
+// counts the requests it receives.
+type feedServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+// newFeedServer starts a feedServer that answers with handler, and stops
+// it when the test ends
+func newFeedServer(t *testing.T, handler http.HandlerFunc) *feedServer {
+	t.Helper()
+	s := &feedServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// serveFixture returns a handler that serves a testdata file as the body
+func serveFixture(t *testing.T, name string) http.HandlerFunc {
+	data := readFixture(t, name)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}
+}
+
+// useFeeds replaces the feed registry for the duration of the test
+func useFeeds(t *testing.T, registry []Feed) {
+	t.Helper()
+	savedFeeds, savedDefault := feeds, defaultFeed
+	feeds = registry
+	defaultFeed = registry[0]
+	t.Cleanup(func() {
+		feeds, defaultFeed = savedFeeds, savedDefault
+	})
+}
+
+// useFeedServer points every feed of the registry at server for the
+// duration of the test, keeping their routes
+func useFeedServer(t *testing.T, server *feedServer) {
+	t.Helper()
+	registry := make([]Feed, len(feeds))
+	for i, feed := range feeds {
+		feed.URL = server.URL + "/" + feed.Name
+		registry[i] = feed
+	}
+	useFeeds(t, registry)
+}
+
+// setGlobal sets a package-level flag variable for the duration of the test
+func setGlobal[T any](t *testing.T, variable *T, value T) {
+	t.Helper()
+	saved := *variable
+	*variable = value
+	t.Cleanup(func() {
+		*variable = saved
+	})
+}
+
+// checkGolden compares got with a golden file in testdata, or rewrites the
+// file when the tests are run with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// resetFlags puts every flag in flags back at its default, as if the command
+// line had not set it
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
+
+// runArrivals runs the arrivals command with args and every other flag at
+// its default, without a config file. It returns the exit status and what
+// the command wrote to stdout and stderr.
+func runArrivals(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	return runCommand(t, arrivalsCmd, args...)
+}
+
+// runCommand runs the subcommand cmd like runArrivals runs arrivals
+func runCommand(t *testing.T, cmd *cobra.Command, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	resetFlags(rootCmd.PersistentFlags())
+	resetFlags(cmd.Flags())
+	t.Cleanup(func() {
+		resetFlags(rootCmd.PersistentFlags())
+		resetFlags(cmd.Flags())
+		rootCmd.SetArgs(nil)
+	})
+
+	dir := t.TempDir()
+	capture := func(name string) *os.File {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	outFile, errFile := capture("stdout"), capture("stderr")
+	setGlobal(t, &os.Stdout, outFile)
+	setGlobal(t, &os.Stderr, errFile)
+	rootCmd.SetOut(outFile)
+	rootCmd.SetErr(errFile)
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+
+	path := strings.Fields(cmd.CommandPath())[1:]
+	rootCmd.SetArgs(append(append(path, "--config="), args...))
+	err := rootCmd.Execute()
+	var exitErr *ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.Code
+	case err != nil:
+		code = 1
+	}
+
+	read := func(f *os.File) string {
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	return code, read(outFile), read(errFile)
+}
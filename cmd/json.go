@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// arrivalRecord is the JSON representation of an arrival
+type arrivalRecord struct {
+	StopID     string     `json:"stop_id"`
+	RouteID    string     `json:"route_id"`
+	Station    string     `json:"station"`
+	TripID     string     `json:"trip_id,omitempty"`
+	StartDate  string     `json:"start_date,omitempty"`
+	StartTime  string     `json:"start_time,omitempty"`
+	Arrival    time.Time  `json:"arrival"`
+	Departure  bool       `json:"departure,omitempty"`
+	Scheduled  bool       `json:"scheduled,omitempty"`
+	TrainID    string     `json:"train_id,omitempty"`
+	Track      string     `json:"track,omitempty"`
+	Updated    *time.Time `json:"updated,omitempty"`
+	StopsAway  *int       `json:"stops_away,omitempty"`
+	ScheduleAt *time.Time `json:"scheduled_arrival,omitempty"`
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+}
+
+// arrivalTrack returns the actual track of an arrival, falling back to the
+// scheduled track
+func arrivalTrack(arrival Arrival) string {
+	if arrival.ActualTrack != "" {
+		return arrival.ActualTrack
+	}
+	return arrival.ScheduledTrack
+}
+
+// newArrivalRecord builds the JSON representation of an arrival
+func newArrivalRecord(arrival Arrival, stopIDToName map[string]string) arrivalRecord {
+	stationName, _ := lookupStationName(arrival.StopID, stopIDToName)
+	record := arrivalRecord{
+		StopID:    arrival.StopID,
+		RouteID:   arrival.RouteID,
+		Station:   stationName,
+		TripID:    arrival.TripID,
+		StartDate: arrival.StartDate,
+		StartTime: arrival.StartTime,
+		Arrival:   arrival.Arrival,
+		Departure: arrival.FromDeparture,
+		Scheduled: arrival.Scheduled,
+		TrainID:   arrival.TrainID,
+		Track:     arrivalTrack(arrival),
+	}
+	if !arrival.Updated.IsZero() {
+		record.Updated = &arrival.Updated
+	}
+	if !arrival.Scheduled {
+		record.StopsAway = &arrival.StopsAway
+	}
+	if !arrival.ScheduledAt.IsZero() {
+		record.ScheduleAt = &arrival.ScheduledAt
+	}
+	return record
+}
+
+// arrivalRecords sorts the arrivals and builds their JSON representations
+func arrivalRecords(arrivals []Arrival, stopIDToName map[string]string) []arrivalRecord {
+	sortArrivals(arrivals)
+
+	records := make([]arrivalRecord, 0, len(arrivals))
+	for _, arrival := range arrivals {
+		records = append(records, newArrivalRecord(arrival, stopIDToName))
+	}
+	return records
+}
+
+// writeArrivalsJSON writes the arrivals to w as a single JSON array
+func writeArrivalsJSON(w io.Writer, arrivals []Arrival, stopIDToName map[string]string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(arrivalRecords(arrivals, stopIDToName)); err != nil {
+		return fmt.Errorf("failed to encode arrivals: %w", err)
+	}
+	return nil
+}
+
+// arrivalsEnvelope is the JSON representation of arrivals with --json-meta:
+// the arrivals along with the query and how fresh the data is
+type arrivalsEnvelope struct {
+	// FeedTimestamp is the header timestamp of the stalest feed, or null
+	// if no feed reported one
+	FeedTimestamp   *time.Time      `json:"feed_timestamp"`
+	FetchedAt       time.Time       `json:"fetched_at"`
+	RequestedRoutes []string        `json:"requested_routes"`
+	Station         string          `json:"station"`
+	Count           int             `json:"count"`
+	Arrivals        []arrivalRecord `json:"arrivals"`
+}
+
+// newArrivalsEnvelope builds the --json-meta representation of the arrivals
+// matching a query for station and routes, from feeds with the given header
+// timestamp fetched at fetchedAt
+func newArrivalsEnvelope(arrivals []Arrival, stopIDToName map[string]string, station string, routes []string, feedTime, fetchedAt time.Time) arrivalsEnvelope {
+	envelope := arrivalsEnvelope{
+		FetchedAt:       fetchedAt,
+		RequestedRoutes: append([]string{}, routes...),
+		Station:         station,
+		Count:           len(arrivals),
+		Arrivals:        arrivalRecords(arrivals, stopIDToName),
+	}
+	if !feedTime.IsZero() {
+		envelope.FeedTimestamp = &feedTime
+	}
+	return envelope
+}
+
+// writeArrivalsEnvelope writes an arrivals envelope to w as a JSON object
+func writeArrivalsEnvelope(w io.Writer, envelope arrivalsEnvelope) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(envelope); err != nil {
+		return fmt.Errorf("failed to encode arrivals: %w", err)
+	}
+	return nil
+}
+
+// writeArrivalsJSONLines writes the arrivals to w as newline-delimited JSON,
+// one object per arrival, each stamped with capturedAt. The batch is flushed
+// as a whole so consumers never see a partial refresh.
+func writeArrivalsJSONLines(w io.Writer, arrivals []Arrival, stopIDToName map[string]string, capturedAt time.Time) error {
+	sortArrivals(arrivals)
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for _, arrival := range arrivals {
+		record := newArrivalRecord(arrival, stopIDToName)
+		record.CapturedAt = &capturedAt
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to encode arrival: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write arrivals: %w", err)
+	}
+	return nil
+}
+
+// batchResult is the JSON representation of one query read with --stdin
+type batchResult struct {
+	Query    string          `json:"query"`
+	Arrivals []arrivalRecord `json:"arrivals"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// newBatchResult builds the JSON representation of a query's arrivals,
+// or of the error resolving it
+func newBatchResult(query string, arrivals []Arrival, err error, stopIDToName map[string]string) batchResult {
+	result := batchResult{Query: query, Arrivals: []arrivalRecord{}}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sortArrivals(arrivals)
+	for _, arrival := range arrivals {
+		result.Arrivals = append(result.Arrivals, newArrivalRecord(arrival, stopIDToName))
+	}
+	return result
+}
+
+// writeBatchJSON writes the results of a batch of queries to w as a single JSON array
+func writeBatchJSON(w io.Writer, results []batchResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return fmt.Errorf("failed to encode arrivals: %w", err)
+	}
+	return nil
+}
+
+// writeJSONError writes err to w as a JSON object: {"error": "..."}
+func writeJSONError(w io.Writer, err error) {
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
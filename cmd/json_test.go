@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestArrivalsJSONMeta(t *testing.T) {
+	server := newFeedServer(t, serveFixture(t, "gtfs.pb"))
+	useFeeds(t, []Feed{{Name: "1234567S", URL: server.URL, Routes: []string{"1", "2", "3", "4", "5", "6", "7", "GS"}}})
+
+	// Run where the fixture stops are the stop data, so parent stop IDs expand
+	stopsData := readFixture(t, "stops.csv")
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "gtfs_subway"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gtfs_subway", "stops.csv"), stopsData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	ResetStopCache()
+	t.Cleanup(ResetStopCache)
+
+	_, stdout, _ := runArrivals(t, "116", "--routes=1", "--json-meta", "--now="+fixtureTime.Format(time.RFC3339))
+	var envelope struct {
+		FeedTimestamp   *time.Time `json:"feed_timestamp"`
+		FetchedAt       time.Time  `json:"fetched_at"`
+		RequestedRoutes []string   `json:"requested_routes"`
+		Station         string     `json:"station"`
+		Count           int        `json:"count"`
+		Arrivals        []struct {
+			StopID string `json:"stop_id"`
+		} `json:"arrivals"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &envelope); err != nil {
+		t.Fatalf("output is not a JSON object: %v\n%s", err, stdout)
+	}
+
+	// The fixture's header timestamp is 15 seconds before it was fetched
+	if envelope.FeedTimestamp == nil || !envelope.FeedTimestamp.Equal(fixtureTime.Add(-15*time.Second)) {
+		t.Errorf("feed_timestamp = %v, want %v", envelope.FeedTimestamp, fixtureTime.Add(-15*time.Second))
+	}
+	if !envelope.FetchedAt.Equal(fixtureTime) {
+		t.Errorf("fetched_at = %v, want %v", envelope.FetchedAt, fixtureTime)
+	}
+	if !slices.Equal(envelope.RequestedRoutes, []string{"1"}) {
+		t.Errorf("requested_routes = %v, want [1]", envelope.RequestedRoutes)
+	}
+	if envelope.Station != "116" {
+		t.Errorf("station = %q, want 116", envelope.Station)
+	}
+	var stops []string
+	for _, arrival := range envelope.Arrivals {
+		stops = append(stops, arrival.StopID)
+	}
+	if want := []string{"116S", "116N", "116S"}; envelope.Count != len(want) || !slices.Equal(stops, want) {
+		t.Errorf("count = %d, arrivals = %v, want %d, %v", envelope.Count, stops, len(want), want)
+	}
+}
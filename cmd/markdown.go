@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// markdownEscaper escapes the characters that would break a cell of a
+// GitHub-flavored Markdown table
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\r", " ", "\n", " ")
+
+// writeMarkdownRow writes one row of a Markdown table
+func writeMarkdownRow(w io.Writer, cells []string) {
+	for i := range cells {
+		cells[i] = markdownEscaper.Replace(cells[i])
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+}
+
+// writeArrivalsMarkdown writes the arrivals as a GitHub-flavored Markdown
+// table with the selected columns, ordered by time. The header row is
+// written even when there are no arrivals.
+func writeArrivalsMarkdown(w io.Writer, arrivals []Arrival, stopIDToName map[string]string, now time.Time) {
+	sortArrivals(arrivals)
+
+	headers := make([]string, len(tableColumns))
+	rule := make([]string, len(tableColumns))
+	for i, col := range tableColumns {
+		headers[i] = col.Header
+		rule[i] = "---"
+	}
+	writeMarkdownRow(w, headers)
+	writeMarkdownRow(w, rule)
+
+	for _, arrival := range arrivals {
+		cells := make([]string, len(tableColumns))
+		for i, col := range tableColumns {
+			cells[i] = col.Value(arrival, stopIDToName, now)
+		}
+		writeMarkdownRow(w, cells)
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteArrivalsMarkdown(t *testing.T) {
+	columns, err := selectColumns([]string{"stop_id", "route", "station", "minutes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &tableColumns, columns)
+	setGlobal(t, &secondsBelow, 0)
+
+	stopIDToName := map[string]string{
+		"101S": `Van Cortlandt | 242 St`,
+		"116S": `Back\slash`,
+	}
+	arrivals := []Arrival{
+		{StopID: "116S", RouteID: "1", Arrival: fixtureTime.Add(5 * time.Minute)},
+		{StopID: "101S", RouteID: "1", Arrival: fixtureTime.Add(3 * time.Minute)},
+	}
+
+	var out bytes.Buffer
+	writeArrivalsMarkdown(&out, arrivals, stopIDToName, fixtureTime)
+	want := `| STOP_ID | ROUTE | STATION | AWAY |
+| --- | --- | --- | --- |
+| 101S | 1 | Van Cortlandt \| 242 St | 3 min |
+| 116S | 1 | Back\\slash | 5 min |
+`
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// The header row is written even without arrivals
+	out.Reset()
+	writeArrivalsMarkdown(&out, nil, stopIDToName, fixtureTime)
+	if want := "| STOP_ID | ROUTE | STATION | AWAY |\n| --- | --- | --- | --- |\n"; out.String() != want {
+		t.Errorf("output without arrivals:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
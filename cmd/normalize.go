@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// abbreviations maps common abbreviations in station names to their
+// expanded form, so "Times Sq" and "times square" normalize the same way
+var abbreviations = map[string]string{
+	"st":   "street",
+	"sts":  "streets",
+	"sq":   "square",
+	"av":   "avenue",
+	"ave":  "avenue",
+	"avs":  "avenues",
+	"blvd": "boulevard",
+	"pkwy": "parkway",
+	"pk":   "park",
+	"pl":   "place",
+	"rd":   "road",
+	"hts":  "heights",
+	"ctr":  "center",
+	"jct":  "junction",
+}
+
+// normalizeStationName lowercases a station name, replaces punctuation with
+// spaces, and expands common abbreviations
+func normalizeStationName(name string) string {
+	return strings.Join(stationTokens(name), " ")
+}
+
+// stationTokens splits a station name into normalized words
+func stationTokens(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if expanded, ok := abbreviations[word]; ok {
+			words[i] = expanded
+		}
+	}
+	return words
+}
+
+// matchStationNames returns the canonical station names matching a query.
+// An exact match wins; otherwise a normalized exact match; otherwise every
+// station whose name contains all the words of the query.
+func matchStationNames(query string, nameToIDs map[string][]string) []string {
+	if _, ok := nameToIDs[query]; ok {
+		return []string{query}
+	}
+
+	normalized := normalizeStationName(query)
+	if normalized == "" {
+		return nil
+	}
+
+	var exact, partial []string
+	queryTokens := stationTokens(query)
+	for name := range nameToIDs {
+		if normalizeStationName(name) == normalized {
+			exact = append(exact, name)
+			continue
+		}
+		if containsAllTokens(stationTokens(name), queryTokens) {
+			partial = append(partial, name)
+		}
+	}
+
+	matches := exact
+	if len(matches) == 0 {
+		matches = partial
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// containsAllTokens reports whether every token in want appears in have
+func containsAllTokens(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, token := range have {
+		set[token] = true
+	}
+	for _, token := range want {
+		if !set[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// maxSuggestions caps the station names offered for a query that matched nothing
+const maxSuggestions = 3
+
+// suggestStations returns up to maxSuggestions station names closest to the
+// query by edit distance, compared both as typed (ignoring case) and with
+// punctuation and abbreviations normalized. Names further than a third of
+// the query's length away are not suggested.
+func suggestStations(query string, nameToIDs map[string][]string) []string {
+	normalized := normalizeStationName(query)
+	if normalized == "" {
+		return nil
+	}
+	lower := strings.ToLower(strings.TrimSpace(query))
+	threshold := max(len([]rune(lower))/3, 1)
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for name := range nameToIDs {
+		d := min(levenshtein(lower, strings.ToLower(name)), levenshtein(normalized, normalizeStationName(name)))
+		if d <= threshold {
+			candidates = append(candidates, candidate{name, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var names []string
+	for _, c := range candidates[:min(len(candidates), maxSuggestions)] {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// levenshtein returns the number of single-rune insertions, deletions, and
+// substitutions needed to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchStationNames(t *testing.T) {
+	nameToIDs := map[string][]string{
+		"Times Sq-42 St":             {"127", "127N", "127S"},
+		"116 St-Columbia University": {"117", "117N", "117S"},
+		"116 St":                     {"227", "227N", "227S"},
+		"Cathedral Pkwy (110 St)":    {"118", "118N", "118S"},
+		"5 Av/53 St":                 {"F12", "F12N", "F12S"},
+		"5 Av":                       {"718", "718N", "718S"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "Times Sq-42 St", want: []string{"Times Sq-42 St"}},
+		{query: "times square", want: []string{"Times Sq-42 St"}},
+		{query: "TIMES SQ 42 ST", want: []string{"Times Sq-42 St"}},
+		{query: "times square 42 street", want: []string{"Times Sq-42 St"}},
+		{query: "42 st", want: []string{"Times Sq-42 St"}},
+		{query: "columbia", want: []string{"116 St-Columbia University"}},
+		{query: "cathedral parkway", want: []string{"Cathedral Pkwy (110 St)"}},
+		{query: "110 street", want: []string{"Cathedral Pkwy (110 St)"}},
+		// A normalized exact match wins over names merely containing it
+		{query: "116 street", want: []string{"116 St"}},
+		{query: "5 avenue", want: []string{"5 Av"}},
+		{query: "fifth avenue", want: nil},
+		{query: "53 st 5 av", want: []string{"5 Av/53 St"}},
+		{query: "st", want: []string{"116 St", "116 St-Columbia University", "5 Av/53 St", "Cathedral Pkwy (110 St)", "Times Sq-42 St"}},
+		{query: "--", want: nil},
+	}
+	for _, tt := range tests {
+		if got := matchStationNames(tt.query, nameToIDs); !slices.Equal(got, tt.want) {
+			t.Errorf("matchStationNames(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// nyctExtension is the field number of the NYCT extensions to
+// TripDescriptor and StopTimeUpdate (nyct-subway.proto). The bindings don't
+// register them, so they are read from the messages' unknown fields.
+const nyctExtension protowire.Number = 1001
+
+// Fields of NyctTripDescriptor and NyctStopTimeUpdate
+const (
+	nyctTrainIDField        protowire.Number = 1
+	nyctScheduledTrackField protowire.Number = 1
+	nyctActualTrackField    protowire.Number = 2
+)
+
+// unknownField returns the concatenated length-delimited values of field num
+// in data, which is how repeated occurrences of a message field merge.
+// Malformed data yields nil.
+func unknownField(data []byte, num protowire.Number) []byte {
+	var value []byte
+	for len(data) > 0 {
+		fieldNum, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+		if fieldNum == num && wireType == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil
+			}
+			value = append(value, v...)
+			data = data[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(fieldNum, wireType, data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+	}
+	return value
+}
+
+// unknownFieldValues returns each length-delimited value of field num in
+// data separately, as needed for repeated strings. Malformed data yields nil.
+func unknownFieldValues(data []byte, num protowire.Number) [][]byte {
+	var values [][]byte
+	for len(data) > 0 {
+		fieldNum, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+		if fieldNum == num && wireType == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil
+			}
+			values = append(values, v)
+			data = data[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(fieldNum, wireType, data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+	}
+	return values
+}
+
+// nyctFields returns the NYCT extension message attached to m, or nil
+func nyctFields(m proto.Message) []byte {
+	if m == nil {
+		return nil
+	}
+	return unknownField(m.ProtoReflect().GetUnknown(), nyctExtension)
+}
+
+// nyctTrainID returns the NYCT train ID of a trip, e.g. "01 1234+ 242/SFY",
+// or an empty string if the feed doesn't provide one
+func nyctTrainID(trip *gtfs.TripDescriptor) string {
+	return string(unknownField(nyctFields(trip), nyctTrainIDField))
+}
+
+// nyctTracks returns the scheduled and actual tracks of a stop time update,
+// each empty if the feed doesn't provide it
+func nyctTracks(update *gtfs.TripUpdate_StopTimeUpdate) (scheduled, actual string) {
+	fields := nyctFields(update)
+	if fields == nil {
+		return "", ""
+	}
+	return string(unknownField(fields, nyctScheduledTrackField)), string(unknownField(fields, nyctActualTrackField))
+}
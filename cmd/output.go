@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// openOutput opens path for writing rendered output, creating parent
+// directories as needed. Existing files are truncated unless appending.
+func openOutput(path string, appendOutput bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create directory for %s: %w", path, err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendOutput {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write to %s: %w", path, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Values accepted by --pager
+const (
+	pagerAuto   = "auto"
+	pagerAlways = "always"
+	pagerNever  = "never"
+)
+
+// defaultPager is used when $PAGER is not set; -R passes colors through
+const defaultPager = "less -R"
+
+// validatePagerMode checks the value of --pager
+func validatePagerMode(mode string) error {
+	switch mode {
+	case pagerAuto, pagerAlways, pagerNever:
+		return nil
+	default:
+		return fmt.Errorf("invalid --pager value %q: must be auto, always, or never", mode)
+	}
+}
+
+// pageOutput writes output to stdout, through $PAGER if mode is always or if
+// mode is auto and the output is taller than the terminal. If the pager
+// cannot be started, the output is written directly.
+func pageOutput(output []byte, mode string) {
+	if !shouldPage(output, mode, terminalHeight(os.Stdout)) {
+		os.Stdout.Write(output)
+		return
+	}
+
+	command := os.Getenv("PAGER")
+	if strings.TrimSpace(command) == "" {
+		command = defaultPager
+	}
+	args := strings.Fields(command)
+	pager := exec.Command(args[0], args[1:]...)
+	pager.Stdin = bytes.NewReader(output)
+	pager.Stdout = os.Stdout
+	pager.Stderr = os.Stderr
+	if err := pager.Run(); err != nil {
+		// A pager that ran and then failed has already shown the output
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			os.Stdout.Write(output)
+		}
+	}
+}
+
+// shouldPage decides whether output needs a pager for a terminal of the
+// given height (0 if unknown)
+func shouldPage(output []byte, mode string, height int) bool {
+	switch mode {
+	case pagerAlways:
+		return true
+	case pagerAuto:
+		return height > 0 && bytes.Count(output, []byte("\n")) >= height
+	default:
+		return false
+	}
+}
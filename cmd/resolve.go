@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// complexRadius is the distance in meters within which stations sharing a
+// name are treated as one complex (Times Sq-42 St) rather than as distinct
+// stations (86 St on the 1 and on the 4, 5, and 6)
+const complexRadius = 250.0
+
+// StopIndex bundles the static stop lookups used to resolve station queries
+type StopIndex struct {
+	StopIDToName map[string]string
+	NameToIDs    map[string][]string
+	// Children maps parent stop IDs to their directional child stops
+	Children map[string][]string
+	// Stops holds stop locations, used to tell apart distinct stations
+	// sharing a name. Names are never treated as shared if it is nil.
+	Stops map[string]Stop
+}
+
+// StationNotFoundError is returned when a query matches no station or stop
+type StationNotFoundError struct {
+	Query string
+	// Suggestions are the closest station names, if any are close enough
+	Suggestions []string
+}
+
+func (e *StationNotFoundError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return fmt.Sprintf("no station or stop found for %q; did you mean: %s?", e.Query, strings.Join(e.Suggestions, ", "))
+	}
+	return fmt.Sprintf("no station or stop found for %q", e.Query)
+}
+
+// AmbiguousStationError is returned when a query matches several stations
+type AmbiguousStationError struct {
+	Query      string
+	Candidates []string
+}
+
+func (e *AmbiguousStationError) Error() string {
+	return fmt.Sprintf("station %q is ambiguous; did you mean: %s?", e.Query, strings.Join(e.Candidates, ", "))
+}
+
+// StationCandidate is one of several distinct stations sharing a name
+type StationCandidate struct {
+	// StopID is the parent stop ID, which selects just this station
+	StopID string
+	// Routes seen at the station, if known
+	Routes []string
+}
+
+func (c StationCandidate) String() string {
+	if len(c.Routes) == 0 {
+		return c.StopID
+	}
+	return fmt.Sprintf("%s (%s)", c.StopID, strings.Join(c.Routes, ", "))
+}
+
+// DuplicateStationError is returned when a station name is shared by
+// several distinct stations, e.g. "86 St" on different lines
+type DuplicateStationError struct {
+	Query      string
+	Candidates []StationCandidate
+	// StopIDs are the stop IDs of every candidate station
+	StopIDs []string
+}
+
+func (e *DuplicateStationError) Error() string {
+	candidates := make([]string, len(e.Candidates))
+	for i, candidate := range e.Candidates {
+		candidates[i] = candidate.String()
+	}
+	return fmt.Sprintf("%d stations are named %q; pick one by parent stop ID or narrow it with --routes: %s",
+		len(e.Candidates), e.Query, strings.Join(candidates, ", "))
+}
+
+// ResolveStation resolves a station query to the stop IDs it refers to.
+// The query may be a stop ID (116N), a parent stop ID (116, expanded to its
+// children), an exact station name, or a loose spelling of a station name
+// ("times square"). Returns a *StationNotFoundError, with the closest names
+// as suggestions, if nothing matches, an
+// *AmbiguousStationError if a loose spelling matches several station names,
+// and a *DuplicateStationError if the name is shared by distinct stations.
+func ResolveStation(query string, index StopIndex) ([]string, error) {
+	// Direct stop ID, expanding parent stations to their children
+	if _, ok := index.StopIDToName[query]; ok {
+		if children := index.Children[query]; len(children) > 0 {
+			return children, nil
+		}
+		return []string{query}, nil
+	}
+
+	// Exact station name
+	if ids := index.NameToIDs[query]; len(ids) > 0 {
+		return checkDuplicates(query, ids, index)
+	}
+
+	// Station name ignoring case, punctuation, and abbreviations
+	names := matchStationNames(query, index.NameToIDs)
+	switch len(names) {
+	case 0:
+		return nil, &StationNotFoundError{Query: query, Suggestions: suggestStations(query, index.NameToIDs)}
+	case 1:
+		return checkDuplicates(names[0], index.NameToIDs[names[0]], index)
+	default:
+		return nil, &AmbiguousStationError{Query: query, Candidates: names}
+	}
+}
+
+// checkDuplicates returns the stop IDs for a station name, or a
+// *DuplicateStationError if they belong to distinct stations
+func checkDuplicates(name string, ids []string, index StopIndex) ([]string, error) {
+	clusters := stationClusters(ids, index.Stops)
+	if len(clusters) < 2 {
+		return ids, nil
+	}
+
+	dup := &DuplicateStationError{Query: name, StopIDs: ids}
+	for _, cluster := range clusters {
+		dup.Candidates = append(dup.Candidates, StationCandidate{StopID: cluster[0]})
+	}
+	return nil, dup
+}
+
+// stationClusters groups the parent stations of the given stops into
+// station complexes. Each cluster is a sorted list of parent stop IDs.
+func stationClusters(ids []string, stops map[string]Stop) [][]string {
+	// Collect the distinct parent stations
+	var parents []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		stop, ok := stops[id]
+		if !ok {
+			continue
+		}
+		parent := id
+		if stop.ParentStation != "" {
+			parent = stop.ParentStation
+		}
+		if _, ok := stops[parent]; ok && !seen[parent] {
+			seen[parent] = true
+			parents = append(parents, parent)
+		}
+	}
+	sort.Strings(parents)
+
+	// Join stations within complexRadius of each other, transitively
+	cluster := make([]int, len(parents))
+	for i := range cluster {
+		cluster[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if cluster[i] != i {
+			cluster[i] = find(cluster[i])
+		}
+		return cluster[i]
+	}
+	for i := range parents {
+		for j := i + 1; j < len(parents); j++ {
+			if distance(stops[parents[i]], stops[parents[j]]) <= complexRadius {
+				cluster[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	var order []int
+	for i, parent := range parents {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], parent)
+	}
+	clusters := make([][]string, len(order))
+	for i, root := range order {
+		clusters[i] = groups[root]
+	}
+	return clusters
+}
+
+// distance returns the great-circle distance between two stops in meters
+func distance(a, b Stop) float64 {
+	const earthRadius = 6371000.0
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
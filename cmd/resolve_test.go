@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolveStation(t *testing.T) {
+	index := testIndex(t)
+
+	tests := []struct {
+		query string
+		want  []string
+		// err checks the error type and contents when no stops are expected
+		err func(*testing.T, error)
+	}{
+		{query: "116N", want: []string{"116N"}},
+		{query: "116", want: []string{"116N", "116S"}},
+		{query: "125 St", want: []string{"116", "116N", "116S"}},
+		{query: "times square", want: []string{"127", "127N", "127S"}},
+		{query: "116 st", want: []string{"117", "117N", "117S"}},
+		{query: "columbia", want: []string{"117", "117N", "117S"}},
+		{
+			query: "96 St",
+			err: func(t *testing.T, err error) {
+				var dup *DuplicateStationError
+				if !errors.As(err, &dup) {
+					t.Fatalf("error = %v, want a *DuplicateStationError", err)
+				}
+				var parents []string
+				for _, candidate := range dup.Candidates {
+					parents = append(parents, candidate.StopID)
+				}
+				if !slices.Equal(parents, []string{"120", "625"}) {
+					t.Errorf("candidates = %v, want [120 625]", parents)
+				}
+			},
+		},
+		{
+			query: "st",
+			err: func(t *testing.T, err error) {
+				var ambiguous *AmbiguousStationError
+				if !errors.As(err, &ambiguous) {
+					t.Fatalf("error = %v, want an *AmbiguousStationError", err)
+				}
+			},
+		},
+		{
+			query: "Tims Sq-42 St",
+			err: func(t *testing.T, err error) {
+				var notFound *StationNotFoundError
+				if !errors.As(err, &notFound) {
+					t.Fatalf("error = %v, want a *StationNotFoundError", err)
+				}
+				if !slices.Equal(notFound.Suggestions, []string{"Times Sq-42 St"}) {
+					t.Errorf("suggestions = %v, want [Times Sq-42 St]", notFound.Suggestions)
+				}
+			},
+		},
+		{
+			query: "xyz",
+			err: func(t *testing.T, err error) {
+				var notFound *StationNotFoundError
+				if !errors.As(err, &notFound) || len(notFound.Suggestions) != 0 {
+					t.Errorf("error = %v, want a *StationNotFoundError without suggestions", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := ResolveStation(tt.query, index)
+			if tt.err != nil {
+				tt.err(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
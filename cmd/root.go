@@ -4,6 +4,7 @@ Copyright © 2026 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -14,20 +15,43 @@ var rootCmd = &cobra.Command{
 	Use:   "mta-cli",
 	Short: "NYC MTA real-time subway information CLI",
 	Long: `mta-cli provides real-time arrival information for the NYC Subway.
-Currently supports lines 1, 2, and 3 (A Division - IRT).`,
+Supports all subway lines, shuttles, and the Staten Island Railway.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateColorMode(colorMode)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// configPath is the path of the config file, shared by all subcommands
+var configPath string
+
+// verbose enables diagnostic output on stderr
+var verbose bool
+
+// stopsFile is the stops data used to name and resolve stations: a CSV file
+// or a GTFS static .zip
+var stopsFile string
+
 func init() {
 	// Define persistent flags for the root command
 	// These will be available to all subcommands
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", defaultConfigPath(), "Path to the JSON config file")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", colorAuto, "Color output: auto, always, or never")
+	rootCmd.PersistentFlags().StringVar(&stopsFile, "stops-file", "gtfs_subway/stops.csv", "Stops data: a stops CSV file or a GTFS static .zip containing stops.txt")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Print diagnostics such as feed fetch timings to stderr")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "assume-yes", false, "Download missing static data without asking first")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable color output (also disabled when NO_COLOR is set)")
 }
 
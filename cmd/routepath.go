@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// parentStation returns the parent station ID of a stop, falling back to
+// the stop ID without its direction suffix
+func parentStation(stopID string, stops map[string]Stop) string {
+	if parent := stops[stopID].ParentStation; parent != "" {
+		return parent
+	}
+	return strings.TrimSuffix(stopID, stopDirection(stopID))
+}
+
+// stationPath converts a route's ordered stop IDs to parent station IDs,
+// optionally reversed
+func stationPath(stopIDs []string, stops map[string]Stop, reverse bool) []string {
+	var path []string
+	seen := make(map[string]bool)
+	for _, stopID := range stopIDs {
+		parent := parentStation(stopID, stops)
+		if !seen[parent] {
+			seen[parent] = true
+			path = append(path, parent)
+		}
+	}
+	if reverse {
+		slices.Reverse(path)
+	}
+	return path
+}
+
+// displayRoutePath writes the arrivals to w stop by stop along the route,
+// from one terminal to the other, with the next few trains in each direction
+func displayRoutePath(w io.Writer, routeID string, path []string, arrivals []Arrival, stopIDToName map[string]string, stops map[string]Stop, now time.Time) {
+	// Bucket arrivals by station and direction
+	byStation := make(map[string]map[string][]Arrival)
+	for _, arrival := range arrivals {
+		parent := parentStation(arrival.StopID, stops)
+		if byStation[parent] == nil {
+			byStation[parent] = make(map[string][]Arrival)
+		}
+		direction := stopDirection(arrival.StopID)
+		byStation[parent][direction] = append(byStation[parent][direction], arrival)
+	}
+
+	name := func(stopID string) string {
+		stationName, _ := lookupStationName(stopID, stopIDToName)
+		return stationName
+	}
+	fmt.Fprintf(w, "Route %s: %s to %s\n", colorRoute(routeID), name(path[0]), name(path[len(path)-1]))
+	fmt.Fprintf(w, "%-35s %-15s %s\n", "STATION", "N", "S")
+	fmt.Fprintln(w, "--------------------------------------------------------------------------------")
+	for _, stationID := range path {
+		next := func(direction string) string {
+			if len(byStation[stationID][direction]) == 0 {
+				return "-"
+			}
+			return formatMinutesList(byStation[stationID][direction], now)
+		}
+		fmt.Fprintf(w, "%s %-15s %s\n", padRight(name(stationID), 35), next("N"), next("S"))
+	}
+	fmt.Fprintf(w, "\nTotal: %d upcoming arrivals\n", len(arrivals))
+}
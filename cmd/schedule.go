@@ -0,0 +1,477 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleHorizon is how far ahead scheduled arrivals are shown
+const scheduleHorizon = time.Hour
+
+// ServiceCalendar represents a single row from GTFS calendar.txt
+type ServiceCalendar struct {
+	Weekdays  [7]bool // indexed by time.Weekday
+	StartDate string  // YYYYMMDD
+	EndDate   string  // YYYYMMDD
+}
+
+// activeOn reports whether the service runs on the given date
+func (c ServiceCalendar) activeOn(date time.Time) bool {
+	day := date.Format("20060102")
+	return c.Weekdays[date.Weekday()] && day >= c.StartDate && day <= c.EndDate
+}
+
+// ScheduledTrip represents a single row from GTFS trips.txt
+type ScheduledTrip struct {
+	RouteID     string
+	ServiceID   string
+	DirectionID string
+}
+
+// StopTime represents a single row from GTFS stop_times.txt
+type StopTime struct {
+	TripID string
+	StopID string
+	// Arrival is the time since the start of the service day; it may
+	// exceed 24 hours for trips running past midnight
+	Arrival time.Duration
+}
+
+// Schedule holds the static schedule for a set of stops
+type Schedule struct {
+	Calendar  map[string]ServiceCalendar
+	Trips     map[string]ScheduledTrip
+	StopTimes []StopTime
+
+	// byTrip indexes StopTimes by realtime trip ID, built by Annotate
+	byTrip map[string][]StopTime
+}
+
+// readCSV opens a file of the static GTFS data that goes with the stops
+// data at source (see openStaticFile) and returns a reader positioned after
+// the header, along with a map of column name -> index
+func readCSV(source, name string) (io.Closer, *csv.Reader, map[string]int, error) {
+	file, err := openStaticFile(source, name)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("failed to read header of %s: %w", name, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	return file, reader, columns, nil
+}
+
+// field returns the named column of a record, or "" if it is missing
+func field(record []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// parseGTFSTime parses an HH:MM:SS time, which may exceed 24:00:00
+func parseGTFSTime(value string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
+
+// LoadCalendar reads calendar.txt from the static data at source and
+// returns service_id -> ServiceCalendar map
+func LoadCalendar(source string) (map[string]ServiceCalendar, error) {
+	file, reader, columns, err := readCSV(source, "calendar.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	days := []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	calendar := make(map[string]ServiceCalendar)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		var service ServiceCalendar
+		for i, day := range days {
+			service.Weekdays[i] = field(record, columns, day) == "1"
+		}
+		service.StartDate = field(record, columns, "start_date")
+		service.EndDate = field(record, columns, "end_date")
+		calendar[field(record, columns, "service_id")] = service
+	}
+
+	return calendar, nil
+}
+
+// LoadTrips reads trips.txt from the static data at source and returns
+// trip_id -> ScheduledTrip map
+func LoadTrips(source string) (map[string]ScheduledTrip, error) {
+	file, reader, columns, err := readCSV(source, "trips.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	trips := make(map[string]ScheduledTrip)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		trips[field(record, columns, "trip_id")] = ScheduledTrip{
+			RouteID:     field(record, columns, "route_id"),
+			ServiceID:   field(record, columns, "service_id"),
+			DirectionID: field(record, columns, "direction_id"),
+		}
+	}
+
+	return trips, nil
+}
+
+// LoadStopTimes reads stop_times.txt from the static data at source,
+// keeping only the rows for the given stops. The file is streamed since it
+// is typically very large.
+func LoadStopTimes(source string, stopIDs map[string]bool) ([]StopTime, error) {
+	file, reader, columns, err := readCSV(source, "stop_times.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var stopTimes []StopTime
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		stopID := field(record, columns, "stop_id")
+		if !stopIDs[stopID] {
+			continue
+		}
+
+		arrival, err := parseGTFSTime(field(record, columns, "arrival_time"))
+		if err != nil {
+			continue
+		}
+		stopTimes = append(stopTimes, StopTime{
+			TripID:  field(record, columns, "trip_id"),
+			StopID:  stopID,
+			Arrival: arrival,
+		})
+	}
+
+	return stopTimes, nil
+}
+
+// LoadRouteStops returns the canonical stop ordering of a route, taken
+// from its longest trip in direction 0 (or in any direction if no trip has
+// a direction), from trips.txt and stop_times.txt in the static data at source
+func LoadRouteStops(source, routeID string) ([]string, error) {
+	trips, err := LoadTrips(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the route's trips, preferring direction 0
+	routeTrips := make(map[string]bool)
+	for tripID, trip := range trips {
+		if baseRoute(trip.RouteID) == routeID && trip.DirectionID == "0" {
+			routeTrips[tripID] = true
+		}
+	}
+	if len(routeTrips) == 0 {
+		for tripID, trip := range trips {
+			if baseRoute(trip.RouteID) == routeID {
+				routeTrips[tripID] = true
+			}
+		}
+	}
+	if len(routeTrips) == 0 {
+		return nil, fmt.Errorf("no scheduled trips found for route %s", routeID)
+	}
+
+	file, reader, columns, err := readCSV(source, "stop_times.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	type stopAt struct {
+		stopID   string
+		sequence int
+	}
+	tripStops := make(map[string][]stopAt)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		tripID := field(record, columns, "trip_id")
+		if !routeTrips[tripID] {
+			continue
+		}
+		sequence, err := strconv.Atoi(field(record, columns, "stop_sequence"))
+		if err != nil {
+			continue
+		}
+		tripStops[tripID] = append(tripStops[tripID], stopAt{field(record, columns, "stop_id"), sequence})
+	}
+
+	// The longest trip covers the whole line; break ties by trip ID so the
+	// result doesn't depend on map order
+	var longest string
+	for tripID, stops := range tripStops {
+		if len(stops) > len(tripStops[longest]) || (len(stops) == len(tripStops[longest]) && tripID < longest) {
+			longest = tripID
+		}
+	}
+	stops := tripStops[longest]
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("no scheduled stops found for route %s", routeID)
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].sequence < stops[j].sequence
+	})
+
+	ordered := make([]string, len(stops))
+	for i, stop := range stops {
+		ordered[i] = stop.stopID
+	}
+	return ordered, nil
+}
+
+// LoadStopRoutes returns the routes scheduled to stop at each stop, as
+// stop_id -> route IDs, from trips.txt and stop_times.txt in the static
+// data at source
+func LoadStopRoutes(source string) (map[string]map[string]bool, error) {
+	trips, err := LoadTrips(source)
+	if err != nil {
+		return nil, err
+	}
+
+	file, reader, columns, err := readCSV(source, "stop_times.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stopRoutes := make(map[string]map[string]bool)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		trip, ok := trips[field(record, columns, "trip_id")]
+		if !ok {
+			continue
+		}
+		stopID := field(record, columns, "stop_id")
+		if stopRoutes[stopID] == nil {
+			stopRoutes[stopID] = make(map[string]bool)
+		}
+		stopRoutes[stopID][baseRoute(trip.RouteID)] = true
+	}
+
+	return stopRoutes, nil
+}
+
+// LoadSchedule loads the static schedule for the given stops from
+// calendar.txt, trips.txt, and stop_times.txt in the static data at source:
+// the GTFS static .zip, or the directory of the stops CSV
+func LoadSchedule(source string, stopIDs []string) (*Schedule, error) {
+	calendar, err := LoadCalendar(source)
+	if err != nil {
+		return nil, err
+	}
+	trips, err := LoadTrips(source)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(stopIDs))
+	for _, id := range stopIDs {
+		wanted[id] = true
+	}
+	stopTimes, err := LoadStopTimes(source, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{Calendar: calendar, Trips: trips, StopTimes: stopTimes}, nil
+}
+
+// serviceLocation returns the timezone the MTA schedule is expressed in
+func serviceLocation() *time.Location {
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		return loc
+	}
+	return time.Local
+}
+
+// serviceDayStart returns the time the stop times of a service day count
+// from. GTFS defines it as noon minus 12 hours, which is midnight except on
+// the days the clocks change.
+func serviceDayStart(serviceDay time.Time) time.Time {
+	noon := time.Date(serviceDay.Year(), serviceDay.Month(), serviceDay.Day(), 12, 0, 0, 0, serviceDay.Location())
+	return noon.Add(-12 * time.Hour)
+}
+
+// Arrivals returns the scheduled arrivals between now and now+horizon
+// for the given routes (all routes if nil)
+func (s *Schedule) Arrivals(routes map[string]bool, now time.Time, horizon time.Duration) []Arrival {
+	loc := serviceLocation()
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var arrivals []Arrival
+	// Trips from yesterday's service day may still be running after midnight
+	for _, serviceDay := range []time.Time{today.AddDate(0, 0, -1), today} {
+		for _, stopTime := range s.StopTimes {
+			trip, ok := s.Trips[stopTime.TripID]
+			if !ok {
+				continue
+			}
+			// Express variants such as 6X count as their route
+			if routes != nil && !routes[baseRoute(trip.RouteID)] {
+				continue
+			}
+			if service, ok := s.Calendar[trip.ServiceID]; !ok || !service.activeOn(serviceDay) {
+				continue
+			}
+
+			t := serviceDayStart(serviceDay).Add(stopTime.Arrival)
+			if t.Before(now) || t.After(now.Add(horizon)) {
+				continue
+			}
+
+			arrivals = append(arrivals, Arrival{
+				StopID:    stopTime.StopID,
+				RouteID:   baseRoute(trip.RouteID),
+				TripID:    stopTime.TripID,
+				StartDate: serviceDay.Format("20060102"),
+				Arrival:   t.Local(),
+				Scheduled: true,
+			})
+		}
+	}
+
+	return arrivals
+}
+
+// realtimeTripID returns the trip ID that the realtime feed uses for a
+// static trip. The MTA prefixes static trip IDs with the service, e.g.
+// "AFA23GEN-1038-Weekday-00_097550_1..N03R" for "097550_1..N03R".
+func realtimeTripID(staticID string) string {
+	if _, tripID, ok := strings.Cut(staticID, "_"); ok {
+		return tripID
+	}
+	return staticID
+}
+
+// ScheduledTime returns the time the schedule gives for the arrival's trip
+// at its stop. Among the static trips matching the realtime trip ID and
+// running on the arrival's service day, the one closest to the prediction
+// is used.
+func (s *Schedule) ScheduledTime(arrival Arrival) (time.Time, bool) {
+	if s.byTrip == nil {
+		s.byTrip = make(map[string][]StopTime)
+		for _, stopTime := range s.StopTimes {
+			tripID := realtimeTripID(stopTime.TripID)
+			s.byTrip[tripID] = append(s.byTrip[tripID], stopTime)
+		}
+	}
+
+	// The trip's start date is its service day; without one, it may be
+	// today's or, after midnight, yesterday's
+	loc := serviceLocation()
+	var serviceDays []time.Time
+	if start, err := time.ParseInLocation("20060102", arrival.StartDate, loc); err == nil {
+		serviceDays = []time.Time{start}
+	} else {
+		local := arrival.Arrival.In(loc)
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		serviceDays = []time.Time{today.AddDate(0, 0, -1), today}
+	}
+
+	var best time.Time
+	for _, stopTime := range s.byTrip[arrival.TripID] {
+		if stopTime.StopID != arrival.StopID {
+			continue
+		}
+		trip, ok := s.Trips[stopTime.TripID]
+		if !ok {
+			continue
+		}
+		for _, serviceDay := range serviceDays {
+			if service, ok := s.Calendar[trip.ServiceID]; !ok || !service.activeOn(serviceDay) {
+				continue
+			}
+			t := serviceDayStart(serviceDay).Add(stopTime.Arrival)
+			if best.IsZero() || t.Sub(arrival.Arrival).Abs() < best.Sub(arrival.Arrival).Abs() {
+				best = t
+			}
+		}
+	}
+	return best.Local(), !best.IsZero()
+}
+
+// Annotate sets ScheduledAt on the realtime arrivals whose trip the
+// schedule has
+func (s *Schedule) Annotate(arrivals []Arrival) {
+	for i := range arrivals {
+		if arrivals[i].Scheduled {
+			continue
+		}
+		if t, ok := s.ScheduledTime(arrivals[i]); ok {
+			arrivals[i].ScheduledAt = t
+		}
+	}
+}
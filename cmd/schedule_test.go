@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// scheduleStops are the stops of testdata/stop_times.txt
+var scheduleStops = []string{"101N", "101S", "116N", "116S", "117N", "117S", "118N", "119N", "120N", "120S", "127N", "127S", "625N", "626N", "627N"}
+
+// testArchive writes a GTFS static .zip of the files in testdata to a
+// temporary directory, nested in a folder as some agencies publish them
+func testArchive(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "google_transit.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	files := map[string]string{
+		"stops.txt":      "stops.csv",
+		"calendar.txt":   "calendar.txt",
+		"trips.txt":      "trips.txt",
+		"stop_times.txt": "stop_times.txt",
+		"transfers.txt":  "transfers.txt",
+	}
+	for name, fixture := range files {
+		w, err := archive.Create("google_transit/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(readFixture(t, fixture)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSchedule(t *testing.T) {
+	sources := map[string]string{
+		"directory": "testdata/stops.csv",
+		"archive":   testArchive(t),
+	}
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			schedule, err := LoadSchedule(source, scheduleStops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(schedule.Calendar) != 2 || len(schedule.Trips) != 5 || len(schedule.StopTimes) != 17 {
+				t.Errorf("loaded %d services, %d trips, %d stop times, want 2, 5, 17",
+					len(schedule.Calendar), len(schedule.Trips), len(schedule.StopTimes))
+			}
+		})
+	}
+
+	// The schedule files are optional, so a missing one is reported as such
+	_, err := LoadSchedule(filepath.Join(t.TempDir(), "stops.csv"), scheduleStops)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestScheduleArrivals(t *testing.T) {
+	schedule, err := LoadSchedule("testdata/stops.csv", scheduleStops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		routes []string
+		want   []string // route/stop at HH:MM
+	}{
+		{
+			name:   "one route",
+			routes: []string{"1"},
+			want: []string{
+				"1/120N 15:03", "1/119N 15:04", "1/118N 15:06", "1/117N 15:08", "1/116N 15:10", "1/101N 15:25",
+				"1/101S 15:05", "1/116S 15:10", "1/117S 15:12", "1/120S 15:17",
+			},
+		},
+		{
+			name:   "express counts as its route",
+			routes: []string{"6"},
+			want:   []string{"6/627N 15:02", "6/626N 15:04", "6/625N 15:08"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, arrival := range schedule.Arrivals(routeSet(tt.routes), fixtureTime, time.Hour) {
+				got = append(got, arrival.RouteID+"/"+arrival.StopID+" "+arrival.Arrival.Format("15:04"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("arrivals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRouteStops(t *testing.T) {
+	want := []string{"127N", "120N", "119N", "118N", "117N", "116N", "101N"}
+	for _, source := range []string{"testdata/stops.csv", testArchive(t)} {
+		got, err := LoadRouteStops(source, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("LoadRouteStops(%s) = %v, want %v", source, got, want)
+		}
+	}
+
+	// Express variants count as their route
+	if got, err := LoadRouteStops("testdata/stops.csv", "6"); err != nil || !slices.Equal(got, []string{"627N", "626N", "625N"}) {
+		t.Errorf("LoadRouteStops(6) = %v, %v", got, err)
+	}
+	if _, err := LoadRouteStops("testdata/stops.csv", "L"); err == nil {
+		t.Error("LoadRouteStops(L) succeeded, want an error")
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	loc := serviceLocation()
+	schedule := &Schedule{
+		Calendar: map[string]ServiceCalendar{
+			"Sunday": {Weekdays: [7]bool{time.Sunday: true}, StartDate: "20260101", EndDate: "20261231"},
+		},
+		Trips: map[string]ScheduledTrip{
+			"AFA26GEN-1038-Sunday-00_090000_1..S03R": {RouteID: "1", ServiceID: "Sunday", DirectionID: "1"},
+		},
+		StopTimes: []StopTime{
+			{TripID: "AFA26GEN-1038-Sunday-00_090000_1..S03R", StopID: "117S", Arrival: 15 * time.Hour},
+		},
+	}
+
+	// The clocks go forward on March 8, 2026 and back on November 1; on
+	// both days, as on any other, stop times read as wall clock times
+	for _, date := range []string{"2026-11-01", "2026-03-08", "2026-10-18"} {
+		want, err := time.ParseInLocation("2006-01-02 15:04", date+" 15:00", loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arrivals := schedule.Arrivals(nil, want.Add(-30*time.Minute), time.Hour)
+		if len(arrivals) != 1 || !arrivals[0].Arrival.Equal(want) {
+			t.Errorf("%s: arrivals = %v, want one at %v", date, arrivals, want)
+			continue
+		}
+
+		realtime := Arrival{
+			StopID:    "117S",
+			TripID:    "090000_1..S03R",
+			StartDate: want.Format("20060102"),
+			Arrival:   want.Add(2 * time.Minute),
+		}
+		if got, ok := schedule.ScheduledTime(realtime); !ok || !got.Equal(want) {
+			t.Errorf("%s: scheduled time = %v, %v, want %v", date, got, ok, want)
+		}
+	}
+}
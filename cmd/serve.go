@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr     string
+	serveInterval time.Duration
+)
+
+// shutdownTimeout bounds how long in-flight requests may take after an interrupt
+const shutdownTimeout = 5 * time.Second
+
+// snapshotCache holds the latest snapshot for each set of routes. Each set is
+// fetched at most once per interval; concurrent requests for the same set
+// share a single upstream fetch and its result. After a failed fetch, the
+// set is retried with a growing delay, and the last good snapshot is served
+// in the meantime.
+type snapshotCache struct {
+	client   *FeedClient
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cachedSnapshot
+}
+
+// cachedSnapshot is the cache entry for one set of routes. Its fields are
+// guarded by the cache mutex.
+type cachedSnapshot struct {
+	snapshot  *Snapshot
+	fetchedAt time.Time
+	// err is the error of the last fetch if it failed, failures how many
+	// fetches in a row did, and retryAt when the next one may start
+	err      error
+	failures int
+	retryAt  time.Time
+	// inflight is the fetch in progress, or nil
+	inflight *snapshotFetch
+}
+
+// snapshotFetch is an upstream fetch shared by every request waiting on it
+type snapshotFetch struct {
+	done     chan struct{} // closed once snapshot and err are set
+	snapshot *Snapshot
+	err      error
+}
+
+// newSnapshotCache returns an empty cache refetching at most once per interval
+func newSnapshotCache(client *FeedClient, interval time.Duration) *snapshotCache {
+	return &snapshotCache{
+		client:   client,
+		interval: interval,
+		entries:  make(map[string]*cachedSnapshot),
+	}
+}
+
+// routesKey returns a cache key that doesn't depend on route order or case
+func routesKey(routes []string) string {
+	normalized := make([]string, 0, len(routes))
+	for route := range routeSet(routes) {
+		normalized = append(normalized, route)
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ",")
+}
+
+// retryDelay returns how long to wait before fetching again after the n-th
+// failed fetch in a row: the Retry-After delay when rate limited, otherwise
+// the cache interval, doubled for each failure after the first
+func (c *snapshotCache) retryDelay(err error, n int) time.Duration {
+	var limited *RateLimitError
+	if !errors.As(err, &limited) {
+		limited = &RateLimitError{}
+	}
+	return rateLimitBackoff(limited, c.interval, n-1)
+}
+
+// Get returns the snapshot for routes, fetching it if the cached one is
+// older than the cache interval. While retries of a failed fetch are
+// pending, it returns the last good snapshot, or the error if there is
+// none. If ctx is done first, Get returns its error; the shared fetch
+// carries on for the other requests.
+func (c *snapshotCache) Get(ctx context.Context, routes []string) (*Snapshot, error) {
+	key := routesKey(routes)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedSnapshot{}
+		c.entries[key] = entry
+	}
+	if entry.snapshot != nil && time.Since(entry.fetchedAt) < c.interval {
+		snapshot := entry.snapshot
+		c.mu.Unlock()
+		return snapshot, nil
+	}
+	if entry.err != nil && time.Now().Before(entry.retryAt) {
+		snapshot, err := entry.snapshot, entry.err
+		c.mu.Unlock()
+		if snapshot != nil {
+			return snapshot, nil
+		}
+		return nil, err
+	}
+	call := entry.inflight
+	if call == nil {
+		call = &snapshotFetch{done: make(chan struct{})}
+		entry.inflight = call
+		// The fetch is shared, so it must outlive the request starting it
+		go c.fetch(context.WithoutCancel(ctx), entry, routes, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.snapshot, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch runs an upstream fetch for entry and hands the result to call's
+// waiters. When it fails, they get the last good snapshot if there is one.
+func (c *snapshotCache) fetch(ctx context.Context, entry *cachedSnapshot, routes []string, call *snapshotFetch) {
+	now := time.Now()
+	call.snapshot, call.err = FetchSnapshot(ctx, ArrivalsOptions{Routes: routes, Now: now, FeedClient: c.client})
+
+	c.mu.Lock()
+	entry.inflight = nil
+	if call.err == nil {
+		entry.snapshot = call.snapshot
+		entry.fetchedAt = now
+		entry.err, entry.failures = nil, 0
+	} else {
+		entry.err = call.err
+		entry.failures++
+		entry.retryAt = now.Add(c.retryDelay(call.err, entry.failures))
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Fetch of %s failed (%v); retrying after %s\n", routesKey(routes), call.err, formatClockSeconds(entry.retryAt))
+		}
+		if entry.snapshot != nil {
+			call.snapshot, call.err = entry.snapshot, nil
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// arrivalsHandler serves /arrivals?station=...&routes=... as a JSON array in
+// the same format as arrivals --json
+type arrivalsHandler struct {
+	cache *snapshotCache
+	index StopIndex
+}
+
+// queryRoutes reads the routes parameter, accepting comma-separated and
+// repeated values and route groups
+func queryRoutes(r *http.Request) []string {
+	var routes []string
+	for _, value := range r.URL.Query()["routes"] {
+		for _, route := range strings.Split(value, ",") {
+			if route = strings.TrimSpace(route); route != "" {
+				routes = append(routes, route)
+			}
+		}
+	}
+	return expandRouteGroups(routes)
+}
+
+// statusForError maps pipeline errors to HTTP status codes
+func statusForError(err error) int {
+	var notFound *StationNotFoundError
+	var ambiguous *AmbiguousStationError
+	var dup *DuplicateStationError
+	var limited *RateLimitError
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound
+	case errors.As(err, &ambiguous), errors.As(err, &dup):
+		return http.StatusBadRequest
+	case errors.As(err, &limited):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeHTTPError writes err as a JSON error body with the given status
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	var limited *RateLimitError
+	if errors.As(err, &limited) && limited.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSONError(w, err)
+}
+
+func (h *arrivalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	routes := queryRoutes(r)
+	if _, err := feedsForRoutes(routes); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	snapshot, err := h.cache.Get(r.Context(), routes)
+	if r.Context().Err() != nil {
+		// The client went away; there is no one to answer
+		return
+	}
+	if err != nil {
+		writeHTTPError(w, statusForError(err), err)
+		return
+	}
+
+	// The snapshot may be up to one cache interval old
+	now := time.Now()
+	var upcoming []Arrival
+	for _, arrival := range snapshot.Arrivals {
+		if !arrival.Arrival.Before(now) {
+			upcoming = append(upcoming, arrival)
+		}
+	}
+
+	filtered, err := filterArrivals(upcoming, r.URL.Query().Get("station"), routes, h.index, false)
+	if err != nil {
+		writeHTTPError(w, statusForError(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !snapshot.Timestamp.IsZero() {
+		w.Header().Set("Last-Modified", snapshot.Timestamp.UTC().Format(http.TimeFormat))
+	}
+	if err := writeArrivalsJSON(w, filtered, h.index.StopIDToName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// newServeMux returns the routes served by the serve command
+func newServeMux(handler *arrivalsHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/arrivals", handler)
+	return mux
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve arrivals as JSON over HTTP",
+	Long: `Starts an HTTP server exposing real-time arrivals as JSON, for home
+dashboards and other local tools.
+
+  GET /arrivals?station=120&routes=1,2
+
+Both parameters are optional and behave like the arrivals command's station
+argument and --routes flag. Responses use the arrivals --json format. Feeds
+are fetched at most once per --interval for each set of routes, however many
+requests arrive. When a fetch fails, the last arrivals fetched are served
+until a retry succeeds, and retries back off while the MTA is unreachable or
+rate limiting. Ctrl+C stops the server after in-flight requests finish.
+
+  mta-cli serve                      # Listen on :8080
+  mta-cli serve --addr 127.0.0.1:9000 --interval 30s`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		if serveInterval <= 0 {
+			return errors.New("--interval must be positive")
+		}
+
+		config, err := LoadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		applyFeedConfigs(config.Feeds)
+
+		// Load stop data once; every request shares it
+		stopIDToName, nameToIDs, err := CachedStopMaps(stopsFile)
+		if err != nil {
+			fmt.Printf("Warning: Could not load stop names: %v\n", err)
+		}
+		stops, err := CachedStops(stopsFile)
+		if err != nil {
+			fmt.Printf("Warning: Could not load stop details: %v\n", err)
+		}
+		handler := &arrivalsHandler{
+			cache: newSnapshotCache(NewFeedClient(nil), serveInterval),
+			index: StopIndex{
+				StopIDToName: applyLabels(stopIDToName, config.Labels),
+				NameToIDs:    nameToIDs,
+				Children:     childStops(stops),
+				Stops:        stops,
+			},
+		}
+
+		server := &http.Server{
+			Addr:              serveAddr,
+			Handler:           newServeMux(handler),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+		fmt.Printf("Serving arrivals on %s (Ctrl+C to stop)\n", serveAddr)
+
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+		}
+
+		fmt.Println("\nShutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", 15*time.Second, "Minimum time between upstream fetches of the same feeds")
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshotCacheFailures(t *testing.T) {
+	fixture := readFixture(t, "gtfs.pb")
+	var failing atomic.Bool
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(fixture)
+	})
+	useFeedServer(t, server)
+
+	const interval = 50 * time.Millisecond
+	cache := newSnapshotCache(NewFeedClient(server.Client()), interval)
+	ctx := context.Background()
+	routes := []string{"1"}
+	get := func(wantRequests int32) *Snapshot {
+		t.Helper()
+		snapshot, err := cache.Get(ctx, routes)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if n := server.requests.Load(); n != wantRequests {
+			t.Fatalf("%d feed requests, want %d", n, wantRequests)
+		}
+		return snapshot
+	}
+
+	good := get(1)
+
+	// A failed fetch serves the last good snapshot, and so does every
+	// request until the retry is due
+	failing.Store(true)
+	time.Sleep(interval + 10*time.Millisecond)
+	for range 5 {
+		if got := get(2); got != good {
+			t.Fatal("Get after a failed fetch did not return the last good snapshot")
+		}
+	}
+
+	// The next retry waits twice as long
+	time.Sleep(interval + 10*time.Millisecond)
+	get(3)
+	time.Sleep(interval + 10*time.Millisecond)
+	get(3)
+
+	// Once a retry succeeds, the new snapshot replaces the old one
+	failing.Store(false)
+	time.Sleep(2 * interval)
+	if got := get(4); got == good {
+		t.Error("Get after a successful retry returned the old snapshot")
+	}
+}
+
+func TestSnapshotCacheColdFailure(t *testing.T) {
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	useFeedServer(t, server)
+
+	// Without a snapshot to fall back on, the error is returned until the
+	// Retry-After delay has passed, without fetching again
+	cache := newSnapshotCache(NewFeedClient(server.Client()), time.Millisecond)
+	for range 3 {
+		if _, err := cache.Get(context.Background(), []string{"1"}); err == nil {
+			t.Fatal("Get succeeded, want the rate limit error")
+		}
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("%d feed requests, want 1", n)
+	}
+	entry := cache.entries[routesKey([]string{"1"})]
+	if wait := time.Until(entry.retryAt); wait < 29*time.Second || wait > 30*time.Second {
+		t.Errorf("retry in %s, want 30s", wait)
+	}
+}
+
+func TestSnapshotCacheSharesFetches(t *testing.T) {
+	fixture := readFixture(t, "gtfs.pb")
+	release := make(chan struct{})
+	server := newFeedServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write(fixture)
+	})
+	useFeedServer(t, server)
+	cache := newSnapshotCache(NewFeedClient(server.Client()), time.Hour)
+
+	// A request that gives up waiting gets its context's error, while the
+	// fetch carries on for the others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.Get(ctx, []string{"1"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get with a canceled context = %v, want context.Canceled", err)
+	}
+
+	const clients = 50
+	snapshots := make([]*Snapshot, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Route order doesn't make a different set
+			routes := []string{"1", "2"}
+			if i%2 == 1 {
+				routes = []string{"2", "1"}
+			}
+			snapshot, err := cache.Get(context.Background(), routes)
+			if err != nil {
+				t.Error(err)
+			}
+			snapshots[i] = snapshot
+		}()
+	}
+	// Let both fetches reach the endpoint and the clients pile up behind them
+	for deadline := time.Now().Add(5 * time.Second); server.requests.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// One fetch for the canceled request's routes, one for everyone else
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("%d feed requests, want 2", n)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot != snapshots[0] {
+			t.Fatal("concurrent requests got different snapshots")
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	// An address already taken fails at startup instead of serving
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"--interval=0"}, want: "Error: --interval must be positive"},
+		{args: []string{"--addr", taken.Addr().String()}, want: "Error: listen tcp " + taken.Addr().String()},
+	}
+	for _, tt := range tests {
+		code, _, stderr := runCommand(t, serveCmd, tt.args...)
+		if code != exitError {
+			t.Errorf("%v: exit status = %d, want %d", tt.args, code, exitError)
+		}
+		if !strings.HasPrefix(stderr, tt.want) || strings.Contains(stderr, "Usage:") {
+			t.Errorf("%v: stderr = %q, want %q without the usage", tt.args, stderr, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// displaySplitDirection writes a station board to w with one row per route
+// and the next northbound and southbound trains in adjacent columns
+func displaySplitDirection(w io.Writer, groups []StationGroup, now time.Time) {
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Station: %s\n", group.Station)
+		fmt.Fprintf(w, "%-8s %-20s %s\n", "ROUTE", "NORTHBOUND", "SOUTHBOUND")
+		fmt.Fprintln(w, "--------------------------------------------------------------------------------")
+
+		// Bucket by route, then by the direction suffix of the stop ID
+		byRoute := make(map[string]map[string][]Arrival)
+		for _, arrival := range group.Arrivals {
+			if byRoute[arrival.RouteID] == nil {
+				byRoute[arrival.RouteID] = make(map[string][]Arrival)
+			}
+			direction := stopDirection(arrival.StopID)
+			byRoute[arrival.RouteID][direction] = append(byRoute[arrival.RouteID][direction], arrival)
+		}
+		routeIDs := make([]string, 0, len(byRoute))
+		for routeID := range byRoute {
+			routeIDs = append(routeIDs, routeID)
+		}
+		sort.Strings(routeIDs)
+
+		for _, routeID := range routeIDs {
+			next := func(direction string) string {
+				if len(byRoute[routeID][direction]) == 0 {
+					return "-"
+				}
+				return formatMinutesList(byRoute[routeID][direction], now)
+			}
+			route := colorRoute(routeID) + padRight(routeID, 8)[len(routeID):]
+			fmt.Fprintf(w, "%s %-20s %s\n", route, next("N"), next("S"))
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	stationsRoutes []string
+	stationsJSON   bool
+)
+
+// stationMatch is a station whose name matched a search
+type stationMatch struct {
+	StopID  string   `json:"stop_id"`
+	Station string   `json:"station"`
+	Routes  []string `json:"routes,omitempty"`
+}
+
+// searchStations returns the stations whose name contains query, ignoring
+// case, ordered by name, then stop ID. Platforms are left out, since every
+// station lists them under its own ID.
+func searchStations(query string, stops map[string]Stop) []stationMatch {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	var matches []stationMatch
+	for id, stop := range stops {
+		if stop.ParentStation != "" || !strings.Contains(strings.ToLower(stop.Name), query) {
+			continue
+		}
+		matches = append(matches, stationMatch{StopID: id, Station: stop.Name})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Station != matches[j].Station {
+			return matches[i].Station < matches[j].Station
+		}
+		return matches[i].StopID < matches[j].StopID
+	})
+	return matches
+}
+
+// stationRoutes returns the routes that stop at each station, sorted, from
+// the routes scheduled at its platforms or at the station itself
+func stationRoutes(stopRoutes map[string]map[string]bool, stops map[string]Stop) map[string][]string {
+	sets := make(map[string]map[string]bool)
+	for stopID, routes := range stopRoutes {
+		station := stopID
+		if parent := stops[stopID].ParentStation; parent != "" {
+			station = parent
+		}
+		if sets[station] == nil {
+			sets[station] = make(map[string]bool)
+		}
+		for routeID := range routes {
+			sets[station][routeID] = true
+		}
+	}
+
+	byStation := make(map[string][]string, len(sets))
+	for station, set := range sets {
+		for routeID := range set {
+			byStation[station] = append(byStation[station], routeID)
+		}
+		sort.Strings(byStation[station])
+	}
+	return byStation
+}
+
+// filterStationRoutes keeps the stations served by at least one of routes
+func filterStationRoutes(matches []stationMatch, routes map[string]bool) []stationMatch {
+	var filtered []stationMatch
+	for _, match := range matches {
+		for _, routeID := range match.Routes {
+			if routes[routeID] {
+				filtered = append(filtered, match)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// displayStationMatches displays the matching stations in a formatted table
+func displayStationMatches(matches []stationMatch, withRoutes bool) {
+	if withRoutes {
+		fmt.Printf("%-10s %-40s %s\n", "STOP_ID", "STATION", "ROUTES")
+	} else {
+		fmt.Printf("%-10s %s\n", "STOP_ID", "STATION")
+	}
+	fmt.Println("--------------------------------------------------------------------------------")
+	for _, match := range matches {
+		if withRoutes {
+			routes := strings.Join(match.Routes, " ")
+			if routes == "" {
+				routes = "-"
+			}
+			fmt.Printf("%-10s %-40s %s\n", match.StopID, match.Station, routes)
+		} else {
+			fmt.Printf("%-10s %s\n", match.StopID, match.Station)
+		}
+	}
+	fmt.Printf("\nTotal: %d stations\n", len(matches))
+}
+
+var stationsCmd = &cobra.Command{
+	Use:   "stations <name>",
+	Short: "Find stations by part of their name",
+	Long: `Lists the stations whose name contains the given text, with their stop
+IDs. Matching ignores case.
+
+When the static schedule (trips.txt and stop_times.txt, read from the
+--stops-file archive or the directory of the stops CSV) is available, the routes stopping at each station are listed too, and --route
+keeps only the stations served by the given routes. That helps pick the
+right stop when a name such as "96 St" appears on several lines.
+
+Examples:
+  mta-cli stations columbia            # 116 St-Columbia University
+  mta-cli stations "96 st" --route 1   # Only the 96 St on the 1
+  mta-cli stations 86 --route 4,5,6    # Any of the 4, 5, or 6
+  mta-cli stations canal --json        # As a JSON array`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		stops, err := CachedStops(stopsFile)
+		if err != nil {
+			return fmt.Errorf("loading stops: %w", err)
+		}
+		matches := searchStations(args[0], stops)
+
+		// The schedule files are optional unless filtering by route
+		stopRoutes, err := LoadStopRoutes(staticSource(cmd, "stop_times.txt", len(stationsRoutes) > 0))
+		if err != nil && len(stationsRoutes) > 0 {
+			return fmt.Errorf("--route needs the static schedule: %w", err)
+		}
+		withRoutes := err == nil
+		if withRoutes {
+			byStation := stationRoutes(stopRoutes, stops)
+			for i := range matches {
+				matches[i].Routes = byStation[matches[i].StopID]
+			}
+		}
+		if len(stationsRoutes) > 0 {
+			matches = filterStationRoutes(matches, routeSet(expandRouteGroups(stationsRoutes)))
+		}
+
+		if stationsJSON {
+			if matches == nil {
+				matches = []stationMatch{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(matches)
+		}
+
+		if len(matches) == 0 {
+			if len(stationsRoutes) > 0 {
+				fmt.Printf("No stations on %s found matching: %s\n", strings.Join(stationsRoutes, ", "), args[0])
+			} else {
+				fmt.Printf("No stations found matching: %s\n", args[0])
+			}
+			return nil
+		}
+		displayStationMatches(matches, withRoutes)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stationsCmd)
+	stationsCmd.Flags().StringSliceVarP(&stationsRoutes, "route", "r", nil, "Only list stations served by these routes, e.g. 1 or 4,5,6 (needs the static schedule)")
+	stationsCmd.Flags().BoolVar(&stationsJSON, "json", false, "Print the matching stations as a JSON array")
+}
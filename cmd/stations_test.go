@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStationRoutes(t *testing.T) {
+	stops, err := LoadStops("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"testdata/stops.csv", testArchive(t)} {
+		stopRoutes, err := LoadStopRoutes(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byStation := stationRoutes(stopRoutes, stops)
+
+		matches := searchStations("96 st", stops)
+		for i := range matches {
+			matches[i].Routes = byStation[matches[i].StopID]
+		}
+		if got := fmt.Sprint(matches); got != "[{120 96 St [1 2]} {625 96 St [6]}]" {
+			t.Errorf("%s: matches = %s", source, got)
+		}
+
+		filtered := filterStationRoutes(matches, routeSet([]string{"6"}))
+		if len(filtered) != 1 || filtered[0].StopID != "625" {
+			t.Errorf("%s: filtered by route 6 = %v, want 625", source, filtered)
+		}
+	}
+}
+
+func TestStationsRouteWithoutSchedule(t *testing.T) {
+	// Stops data without the schedule files next to it
+	stops := filepath.Join(t.TempDir(), "stops.csv")
+	if err := os.WriteFile(stops, readFixture(t, "stops.csv"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCommand(t, stationsCmd, "96 st", "--route", "1", "--stops-file", stops)
+	if code != exitError {
+		t.Errorf("exit status = %d, want %d", code, exitError)
+	}
+	if !strings.HasPrefix(stderr, "Error: --route needs the static schedule: ") || strings.Contains(stderr, "Usage:") {
+		t.Errorf("stderr = %q, want the error without the usage", stderr)
+	}
+}
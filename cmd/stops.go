@@ -1,22 +1,211 @@
 package cmd
 
 import (
+	"archive/zip"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-func LoadStopData(path string) (map[string]string, error) {
+// stopColumns are the stops.txt columns the loaders read, in the order they
+// expect them. This is the layout of the subway's stops.txt.
+var stopColumns = []string{"stop_id", "stop_name", "stop_lat", "stop_lon", "location_type", "parent_station"}
+
+// readStopRecords reads the CSV records of a stops file, header included.
+// The path may be a plain CSV file or a GTFS static .zip, in which case
+// stops.txt is read from the archive.
+func readStopRecords(path string) ([][]string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open stops file: %w", err)
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	magic := make([]byte, len(zipMagic))
+	if n, _ := io.ReadFull(file, magic); n == len(magic) && string(magic) == zipMagic {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stops file: %w", err)
+		}
+		archive, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open GTFS archive: %w", err)
+		}
+		return readZipStopRecords(archive)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read stops file: %w", err)
+	}
+	return readStopCSV(file)
+}
+
+// zipMagic is the signature at the start of a zip archive
+const zipMagic = "PK\x03\x04"
+
+// isArchive reports whether the file at path is a zip archive
+func isArchive(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(zipMagic))
+	n, _ := io.ReadFull(file, magic)
+	return n == len(magic) && string(magic) == zipMagic
+}
+
+// archiveEntry is a file opened in a zip archive; closing it closes the
+// archive too
+type archiveEntry struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (e archiveEntry) Close() error {
+	e.ReadCloser.Close()
+	return e.archive.Close()
+}
+
+// openStaticFile opens a file of the static GTFS data that goes with the
+// stops data at source, e.g. trips.txt: the entry in the archive when source
+// is a GTFS static .zip, or the file next to it otherwise. A missing file is
+// reported as an error wrapping os.ErrNotExist.
+func openStaticFile(source, name string) (io.ReadCloser, error) {
+	if !isArchive(source) {
+		return os.Open(filepath.Join(filepath.Dir(source), name))
+	}
+
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GTFS archive: %w", err)
+	}
+	for _, entry := range archive.File {
+		if path.Base(entry.Name) != name {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("failed to open %s in GTFS archive: %w", name, err)
+		}
+		return archiveEntry{ReadCloser: r, archive: archive}, nil
+	}
+	archive.Close()
+	return nil, fmt.Errorf("GTFS archive %s has no %s: %w", source, name, os.ErrNotExist)
+}
+
+// readZipStopRecords reads the records of stops.txt in a GTFS static archive.
+// Feeds published with a top-level directory are accepted too.
+func readZipStopRecords(archive *zip.Reader) ([][]string, error) {
+	for _, entry := range archive.File {
+		if path.Base(entry.Name) != "stops.txt" {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stops.txt in GTFS archive: %w", err)
+		}
+		defer r.Close()
+		return readStopCSV(r)
+	}
+	return nil, fmt.Errorf("GTFS archive has no stops.txt")
+}
+
+// readCSVRecords reads every record of a GTFS CSV file. Rows may have any
+// number of fields, since optional trailing columns are often left off. A
+// malformed row, such as one with a stray quote, is skipped rather than
+// failing the whole file; the number skipped is reported on stderr.
+func readCSVRecords(r io.Reader, name string) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var records [][]string
+	skipped := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d malformed row(s) in %s\n", skipped, name)
+	}
+	return records, nil
+}
+
+// readStopCSV parses stops CSV from r. Columns are reordered to stopColumns
+// using the header, so GTFS feeds with other column layouts, such as the
+// commuter railroads', load too. Without a recognizable header the columns
+// are used as they are.
+func readStopCSV(r io.Reader) ([][]string, error) {
+	records, err := readCSVRecords(r, "stops file")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return records, nil
+	}
+
+	index := make(map[string]int)
+	for i, name := range records[0] {
+		index[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	_, hasID := index["stop_id"]
+	_, hasName := index["stop_name"]
+	if !hasID || !hasName {
+		return records, nil
+	}
+
+	for i, record := range records {
+		// Rows without a name are skipped by the loaders either way
+		if len(record) < 2 {
+			continue
+		}
+		row := make([]string, len(stopColumns))
+		for j, name := range stopColumns {
+			if k, ok := index[name]; ok && k < len(record) {
+				row[j] = record[k]
+			}
+		}
+		records[i] = row
+	}
+	return records, nil
+}
+
+// minStopRows is the fewest stops a usable stops file can contain.
+// Anything less almost certainly means the file is malformed.
+const minStopRows = 10
+
+// checkStopCount returns an error if too few stops were parsed from path
+func checkStopCount(path string, count int) error {
+	if count < minStopRows {
+		return fmt.Errorf("stops file %s looks malformed: only %d usable rows (expected at least %d)", path, count, minStopRows)
+	}
+	return nil
+}
+
+func LoadStopData(path string) (map[string]string, error) {
+	records, err := readStopRecords(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, err
 	}
 
 	stopMap := make(map[string]string)
@@ -38,6 +227,10 @@ func LoadStopData(path string) (map[string]string, error) {
 		stopMap[stopID] = stopName
 	}
 
+	if err := checkStopCount(path, len(stopMap)); err != nil {
+		return nil, err
+	}
+
 	return stopMap, nil
 }
 
@@ -45,16 +238,9 @@ func LoadStopData(path string) (map[string]string, error) {
 // stop_id -> stop_name map
 // stop_name -> []stop_id map (for reverse lookup)
 func LoadStopMaps(path string) (map[string]string, map[string][]string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open stops file: %w", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	records, err := readStopRecords(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, nil, err
 	}
 
 	stopMap := make(map[string]string)
@@ -76,5 +262,183 @@ func LoadStopMaps(path string) (map[string]string, map[string][]string, error) {
 		nameToIDs[stopName] = append(nameToIDs[stopName], stopID)
 	}
 
+	if err := checkStopCount(path, len(stopMap)); err != nil {
+		return nil, nil, err
+	}
+
 	return stopMap, nameToIDs, nil
 }
+
+// Stop represents a single row from GTFS stops.txt
+type Stop struct {
+	ID            string
+	Name          string
+	Lat           float64
+	Lon           float64
+	LocationType  string
+	ParentStation string
+}
+
+// LoadStops reads a GTFS stops.txt file and returns stop_id -> Stop map
+func LoadStops(path string) (map[string]Stop, error) {
+	records, err := readStopRecords(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stops := make(map[string]Stop)
+
+	// 0: stop_id, 1: stop_name, 2: stop_lat, 3: stop_lon, 4: location_type, 5: parent_station
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+
+		if len(record) < 2 {
+			continue
+		}
+
+		stop := Stop{
+			ID:   record[0],
+			Name: record[1],
+		}
+		if len(record) > 3 {
+			stop.Lat, _ = strconv.ParseFloat(record[2], 64)
+			stop.Lon, _ = strconv.ParseFloat(record[3], 64)
+		}
+		if len(record) > 4 {
+			stop.LocationType = record[4]
+		}
+		if len(record) > 5 {
+			stop.ParentStation = record[5]
+		}
+
+		stops[stop.ID] = stop
+	}
+
+	if err := checkStopCount(path, len(stops)); err != nil {
+		return nil, err
+	}
+
+	return stops, nil
+}
+
+// stopMapsEntry holds the parsed stop maps for a single stops file
+type stopMapsEntry struct {
+	once      sync.Once
+	stopMap   map[string]string
+	nameToIDs map[string][]string
+	err       error
+}
+
+// stopCache caches parsed stop maps, keyed by path
+var stopCache sync.Map
+
+// CachedStopMaps behaves like LoadStopMaps but parses each path at most once
+// per process. It is safe for concurrent use. The returned maps are shared
+// between callers and must not be modified.
+func CachedStopMaps(path string) (map[string]string, map[string][]string, error) {
+	value, _ := stopCache.LoadOrStore(path, &stopMapsEntry{})
+	entry := value.(*stopMapsEntry)
+	entry.once.Do(func() {
+		entry.stopMap, entry.nameToIDs, entry.err = LoadStopMaps(path)
+	})
+	return entry.stopMap, entry.nameToIDs, entry.err
+}
+
+// ResetStopCache discards all cached stop maps, so the next CachedStopMaps
+// call re-reads the file
+func ResetStopCache() {
+	stopCache.Clear()
+	stopsCache.Clear()
+}
+
+// stopsEntry holds the parsed stops for a single stops file
+type stopsEntry struct {
+	once  sync.Once
+	stops map[string]Stop
+	err   error
+}
+
+// stopsCache caches parsed stops, keyed by path
+var stopsCache sync.Map
+
+// CachedStops behaves like LoadStops but parses each path at most once per
+// process. It is safe for concurrent use. The returned map is shared between
+// callers and must not be modified.
+func CachedStops(path string) (map[string]Stop, error) {
+	value, _ := stopsCache.LoadOrStore(path, &stopsEntry{})
+	entry := value.(*stopsEntry)
+	entry.once.Do(func() {
+		entry.stops, entry.err = LoadStops(path)
+	})
+	return entry.stops, entry.err
+}
+
+// childStops returns parent_station -> []stop_id, e.g. 116 -> [116N, 116S]
+func childStops(stops map[string]Stop) map[string][]string {
+	children := make(map[string][]string)
+	for id, stop := range stops {
+		if stop.ParentStation != "" {
+			children[stop.ParentStation] = append(children[stop.ParentStation], id)
+		}
+	}
+	for parent := range children {
+		sort.Strings(children[parent])
+	}
+	return children
+}
+
+// Transfer represents a single row from GTFS transfers.txt
+type Transfer struct {
+	FromStopID      string
+	ToStopID        string
+	TransferType    string
+	MinTransferTime int // seconds, 0 if not specified
+}
+
+// LoadTransfers reads transfers.txt from the static data that goes with the
+// stops data at source (see openStaticFile) and returns
+// from_stop_id -> []Transfer map
+func LoadTransfers(source string) (map[string][]Transfer, error) {
+	file, err := openStaticFile(source, "transfers.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transfers file: %w", err)
+	}
+	defer file.Close()
+
+	records, err := readCSVRecords(file, "transfers file")
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make(map[string][]Transfer)
+
+	// 0: from_stop_id, 1: to_stop_id, 2: transfer_type, 3: min_transfer_time
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+
+		if len(record) < 2 {
+			continue
+		}
+
+		transfer := Transfer{
+			FromStopID: record[0],
+			ToStopID:   record[1],
+		}
+		if len(record) > 2 {
+			transfer.TransferType = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			if seconds, err := strconv.Atoi(record[3]); err == nil {
+				transfer.MinTransferTime = seconds
+			}
+		}
+
+		transfers[transfer.FromStopID] = append(transfers[transfer.FromStopID], transfer)
+	}
+
+	return transfers, nil
+}
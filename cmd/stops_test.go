@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadStopMaps(t *testing.T) {
+	stopIDToName, nameToIDs, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(stopIDToName); got != 30 {
+		t.Errorf("stops = %d, want 30", got)
+	}
+	for id, want := range map[string]string{"117": "116 St-Columbia University", "116S": "125 St", "625N": "96 St"} {
+		if got := stopIDToName[id]; got != want {
+			t.Errorf("name of %s = %q, want %q", id, got, want)
+		}
+	}
+	if got := nameToIDs["96 St"]; !slices.Equal(got, []string{"120", "120N", "120S", "625", "625N", "625S"}) {
+		t.Errorf("stops named 96 St = %v", got)
+	}
+}
+
+// writeStops writes a stops file with the given contents to a temporary
+// directory and returns its path
+func writeStops(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stops.csv")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadStopsMalformed(t *testing.T) {
+	// A single column: no row has a name, so nothing is usable
+	path := writeStops(t, strings.Repeat("101N\n", 30))
+
+	if _, err := LoadStopData(path); err == nil || !strings.Contains(err.Error(), "looks malformed") {
+		t.Errorf("LoadStopData error = %v, want a malformed file error", err)
+	}
+	if _, _, err := LoadStopMaps(path); err == nil || !strings.Contains(err.Error(), "looks malformed") {
+		t.Errorf("LoadStopMaps error = %v, want a malformed file error", err)
+	}
+	if _, err := LoadStops(path); err == nil {
+		t.Error("LoadStops succeeded, want an error")
+	}
+}
+
+func TestLoadStopsRaggedRows(t *testing.T) {
+	good := strings.SplitAfter(string(readFixture(t, "stops.csv")), "\n")
+	rows := append([]string{}, good[:12]...)
+	rows = append(rows,
+		"999N\n", // short
+		"998N,Extra Av,40.8,-73.9,,998,wheelchair,platform,more\n", // long
+		"997N,\"Bad \"quote\",40.8,-73.9,,997\n",                   // not valid CSV
+	)
+	rows = append(rows, good[12:]...)
+	path := writeStops(t, strings.Join(rows, ""))
+
+	// Capture the warning about the skipped row
+	warnings, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &os.Stderr, warnings)
+
+	stopIDToName, _, err := LoadStopMaps(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(stopIDToName); got != 31 {
+		t.Errorf("stops = %d, want the 30 good ones and the long row", got)
+	}
+	if stopIDToName["998N"] != "Extra Av" {
+		t.Errorf("long row name = %q, want Extra Av", stopIDToName["998N"])
+	}
+	for _, id := range []string{"999N", "997N"} {
+		if _, ok := stopIDToName[id]; ok {
+			t.Errorf("stop %s was loaded, want it skipped", id)
+		}
+	}
+
+	stderr, err := os.ReadFile(warnings.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stderr), "skipped 1 malformed row(s)") {
+		t.Errorf("stderr = %q, want a warning about the malformed row", stderr)
+	}
+}
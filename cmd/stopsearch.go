@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var stopsJSON bool
+
+// stopMatch is a stop whose ID matched a search
+type stopMatch struct {
+	StopID        string `json:"stop_id"`
+	Station       string `json:"station"`
+	Direction     string `json:"direction,omitempty"`
+	ParentStation string `json:"parent_station,omitempty"`
+}
+
+// searchStopIDs returns the stops whose ID contains query, ignoring case,
+// ordered by stop ID
+func searchStopIDs(query string, stops map[string]Stop) []stopMatch {
+	query = strings.ToUpper(strings.TrimSpace(query))
+
+	var matches []stopMatch
+	for id, stop := range stops {
+		if !strings.Contains(strings.ToUpper(id), query) {
+			continue
+		}
+		match := stopMatch{StopID: id, Station: stop.Name, ParentStation: stop.ParentStation}
+		// Only child stops have a direction; parent IDs like N10 end in a digit
+		if stop.ParentStation != "" {
+			match.Direction = stopDirection(id)
+		}
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].StopID < matches[j].StopID
+	})
+	return matches
+}
+
+// displayStopMatches displays the matching stops in a formatted table
+func displayStopMatches(matches []stopMatch) {
+	fmt.Printf("%-10s %-10s %s\n", "STOP_ID", "DIRECTION", "STATION")
+	fmt.Println("--------------------------------------------------------------------------------")
+	for _, match := range matches {
+		direction := match.Direction
+		if direction == "" {
+			direction = "-"
+		}
+		fmt.Printf("%-10s %-10s %s\n", match.StopID, direction, match.Station)
+	}
+	fmt.Printf("\nTotal: %d stops\n", len(matches))
+}
+
+var stopsCmd = &cobra.Command{
+	Use:   "stops <partial stop ID>",
+	Short: "Find stops by part of their stop ID",
+	Long: `Lists the stops whose ID contains the given text, with their station
+names and directions. Matching ignores case.
+
+Examples:
+  mta-cli stops 11           # 110, 110N, 110S, 111, ...
+  mta-cli stops a2           # A20, A21, ... on the 8 Av line
+  mta-cli stops 116 --json   # As a JSON array`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		stops, err := CachedStops(stopsFile)
+		if err != nil {
+			return fmt.Errorf("loading stops: %w", err)
+		}
+
+		matches := searchStopIDs(args[0], stops)
+		if stopsJSON {
+			if matches == nil {
+				matches = []stopMatch{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(matches)
+		}
+
+		if len(matches) == 0 {
+			fmt.Printf("No stops found matching: %s\n", args[0])
+			return nil
+		}
+		displayStopMatches(matches)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopsCmd)
+	stopsCmd.Flags().BoolVar(&stopsJSON, "json", false, "Print the matching stops as a JSON array")
+}
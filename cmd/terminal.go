@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// clearSequence homes the cursor and clears the terminal
+const clearSequence = "\033[H\033[2J"
+
+// screenClearer returns the function watch mode uses to clear the screen
+// on w between refreshes. Where escape sequences don't work, such as older
+// Windows consoles, boards are separated by a rule instead.
+func screenClearer(w io.Writer, escapes bool) func() {
+	if escapes {
+		return func() { fmt.Fprint(w, clearSequence) }
+	}
+	return func() { fmt.Fprint(w, "\n"+strings.Repeat("=", 80)+"\n\n") }
+}
+
+// hyperlink wraps text in an OSC 8 terminal hyperlink to url
+func hyperlink(url, text string) string {
+	return fmt.Sprintf("\033]8;;%s\033\\%s\033]8;;\033\\", url, text)
+}
+
+// padRight pads text with spaces to width visible characters. Unlike %-*s,
+// padding is computed before any escape sequences are added around text.
+func padRight(text string, width int) string {
+	if n := utf8.RuneCountInString(text); n < width {
+		return text + strings.Repeat(" ", width-n)
+	}
+	return text
+}
+
+// spinnerFrames are the animation frames of the fetch spinner
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner shows an animated progress indicator on stderr
+type Spinner struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startSpinner starts a spinner with the given message on stderr.
+// It does nothing unless stderr is a terminal.
+func startSpinner(message string) *Spinner {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	s := &Spinner{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(os.Stderr, "\r%s %s", spinnerFrames[i%len(spinnerFrames)], message)
+			select {
+			case <-s.stop:
+				fmt.Fprint(os.Stderr, "\r\033[K") // Clear the spinner line
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// Stop stops the spinner and clears it from the terminal
+func (s *Spinner) Stop() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestScreenClearer(t *testing.T) {
+	tests := []struct {
+		name    string
+		escapes bool
+		want    string
+	}{
+		{"escapes", true, clearSequence},
+		{"no escapes", false, "\n" + strings.Repeat("=", 80) + "\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			screenClearer(&buf, tt.escapes)()
+			if got := buf.String(); got != tt.want {
+				t.Errorf("cleared with %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnableEscapes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("depends on the console")
+	}
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !enableEscapes(f) {
+		t.Error("enableEscapes = false, want true outside Windows")
+	}
+}
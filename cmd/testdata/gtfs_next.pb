@@ -0,0 +1,24 @@
+
+
+2.0
+000001
+'
+097550_1..N03R14:15:3020261016*1"127N"120N"117N"116N"101N 
+000002{
+'
+098200_1..S03R14:43:0020261016*1"116S<"117S<"120S a
+000003W
+'
+097600_2..S01R14:16:0020261016*2"120S"127S _
+000004U
+%
+098000_6..N14:20:0020261016*6X"626N"625N a
+000005W
+'
+099000_1..S03R15:10:0020261016*1"101S"116S %
+000006"
+
+097550_1..N03R*1:120Ni
+000007_
+'
+098500_1..S03R14:45:0020261016*1"116S"117S 
\ No newline at end of file
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Layouts for clock times; the seconds variants are used in the watch footer
+const (
+	clock12Hour        = "3:04 PM"
+	clock12HourSeconds = "3:04:05 PM"
+	clock24Hour        = "15:04"
+	clock24HourSeconds = "15:04:05"
+)
+
+// Layouts selected by --24h and --time-format
+var (
+	clockLayout        = clock12Hour
+	clockLayoutSeconds = clock12HourSeconds
+)
+
+// setClockLayout selects the layouts for clock times. A custom layout is
+// used everywhere, with or without seconds; otherwise use24Hour picks
+// between the 12-hour and 24-hour defaults.
+func setClockLayout(use24Hour bool, custom string) error {
+	if custom != "" {
+		if use24Hour {
+			return errors.New("--24h cannot be combined with --time-format")
+		}
+		if err := validateTimeLayout(custom); err != nil {
+			return err
+		}
+		clockLayout, clockLayoutSeconds = custom, custom
+		return nil
+	}
+	if use24Hour {
+		clockLayout, clockLayoutSeconds = clock24Hour, clock24HourSeconds
+		return nil
+	}
+	clockLayout, clockLayoutSeconds = clock12Hour, clock12HourSeconds
+	return nil
+}
+
+// validateTimeLayout rejects layouts that contain no time fields, which
+// would print the same text for every arrival
+func validateTimeLayout(layout string) error {
+	sample := time.Date(2024, time.May, 1, 17, 8, 9, 0, time.UTC)
+	if sample.Format(layout) == layout {
+		return fmt.Errorf("invalid --time-format %q: no time fields, expected a Go layout such as 15:04", layout)
+	}
+	return nil
+}
+
+// formatClock formats t with the selected clock layout
+func formatClock(t time.Time) string {
+	return t.Format(clockLayout)
+}
+
+// formatClockSeconds formats t with the selected clock layout, including seconds
+func formatClockSeconds(t time.Time) string {
+	return t.Format(clockLayoutSeconds)
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// stationTransfers returns the transfers available from a station name or stop ID,
+// excluding transfers from a stop to itself
+func stationTransfers(station string, nameToIDs map[string][]string, transfers map[string][]Transfer) []Transfer {
+	// Accept either a station name or a stop ID
+	stopIDs := nameToIDs[station]
+	if len(stopIDs) == 0 {
+		stopIDs = []string{station}
+	}
+
+	var result []Transfer
+	for _, id := range stopIDs {
+		for _, transfer := range transfers[id] {
+			if transfer.ToStopID == transfer.FromStopID {
+				continue
+			}
+			result = append(result, transfer)
+		}
+	}
+
+	return result
+}
+
+// transferRoutes returns the routes serving the stop a transfer leads to,
+// looking them up by its parent station when it is a platform
+func transferRoutes(transfer Transfer, byStation map[string][]string, stops map[string]Stop) []string {
+	station := transfer.ToStopID
+	if parent := stops[station].ParentStation; parent != "" {
+		station = parent
+	}
+	return byStation[station]
+}
+
+// displayTransfers writes the transfers to w in a formatted table, with the
+// routes you can transfer to at each stop. byStation maps stations to the
+// routes serving them; without it, the routes are shown as "-".
+func displayTransfers(w io.Writer, transfers []Transfer, stopIDToName map[string]string, byStation map[string][]string, stops map[string]Stop) {
+	// Sort by destination station name for readability
+	sort.Slice(transfers, func(i, j int) bool {
+		return stopIDToName[transfers[i].ToStopID] < stopIDToName[transfers[j].ToStopID]
+	})
+
+	fmt.Fprintf(w, "%-10s %-35s %-12s %s\n", "STOP_ID", "STATION", "ROUTES", "MIN_TRANSFER_TIME")
+	fmt.Fprintln(w, "--------------------------------------------------------------------------------")
+	for _, transfer := range transfers {
+		stationName := stopIDToName[transfer.ToStopID]
+		if stationName == "" {
+			stationName = "(unknown)"
+		}
+		routes := "-"
+		if ids := transferRoutes(transfer, byStation, stops); len(ids) > 0 {
+			routes = strings.Join(ids, " ")
+		}
+		minTime := "-"
+		if transfer.MinTransferTime > 0 {
+			minTime = fmt.Sprintf("%d min", (transfer.MinTransferTime+59)/60)
+		}
+		fmt.Fprintf(w, "%-10s %-35s %-12s %s\n", transfer.ToStopID, stationName, routes, minTime)
+	}
+	fmt.Fprintf(w, "\nTotal: %d transfers\n", len(transfers))
+}
+
+var transfersCmd = &cobra.Command{
+	Use:   "transfers <station>",
+	Short: "List the transfers available at a station",
+	Long: `Lists the stations and stops you can transfer to from a given station,
+with the routes serving each, using transfers.txt from the static GTFS data.
+The static files are read from the --stops-file archive, or from the
+directory of the stops CSV. The routes come from trips.txt and
+stop_times.txt; without them, only the stops are listed.
+
+Specify the station by name or stop ID:
+  mta-cli transfers "Times Sq-42 St"   # By station name
+  mta-cli transfers 127                # By stop ID`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only argument errors need the usage
+		cmd.SilenceUsage = true
+
+		station := args[0]
+		out, errOut := cmd.OutOrStdout(), cmd.ErrOrStderr()
+
+		// Load stop mappings
+		stopIDToName, nameToIDs, err := CachedStopMaps(stopsFile)
+		if err != nil {
+			fmt.Fprintf(errOut, "Warning: Could not load stop names: %v\n", err)
+			fmt.Fprintln(errOut, "Will display stop IDs only.")
+		}
+
+		// Load transfers
+		transfers, err := LoadTransfers(staticSource(cmd, "transfers.txt", true))
+		if err != nil {
+			return fmt.Errorf("loading transfers: %w", err)
+		}
+
+		result := stationTransfers(station, nameToIDs, transfers)
+		if len(result) == 0 {
+			fmt.Fprintf(out, "No transfers found for station: %s\n", station)
+			return nil
+		}
+
+		// The schedule files are optional; without them the routes are unknown
+		var byStation map[string][]string
+		stops, _ := CachedStops(stopsFile)
+		if stopRoutes, err := LoadStopRoutes(staticSource(cmd, "stop_times.txt", false)); err == nil {
+			byStation = stationRoutes(stopRoutes, stops)
+		}
+
+		displayTransfers(out, result, stopIDToName, byStation, stops)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(transfersCmd)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransfers(t *testing.T) {
+	stopIDToName, nameToIDs, err := LoadStopMaps("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stops, err := LoadStops("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"testdata/stops.csv", testArchive(t)} {
+		transfers, err := LoadTransfers(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stopRoutes, err := LoadStopRoutes(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		displayTransfers(&out, stationTransfers("Times Sq-42 St", nameToIDs, transfers), stopIDToName, stationRoutes(stopRoutes, stops), stops)
+		want := `STOP_ID    STATION                             ROUTES       MIN_TRANSFER_TIME
+--------------------------------------------------------------------------------
+120        96 St                               1 2          2 min
+
+Total: 1 transfers
+`
+		if out.String() != want {
+			t.Errorf("%s: output:\n%s\nwant:\n%s", source, out.String(), want)
+		}
+	}
+
+	// Without the schedule files the routes are unknown
+	var out bytes.Buffer
+	transfers, err := LoadTransfers("testdata/stops.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	displayTransfers(&out, stationTransfers("625", nameToIDs, transfers), stopIDToName, nil, stops)
+	if want := "120        96 St                               -            5 min\n"; !bytes.Contains(out.Bytes(), []byte(want)) {
+		t.Errorf("output:\n%s\nwant a row %q", out.String(), want)
+	}
+}
+
+func TestTransfersMissingFile(t *testing.T) {
+	// Stops data without a transfers.txt next to it
+	stops := filepath.Join(t.TempDir(), "stops.csv")
+	if err := os.WriteFile(stops, readFixture(t, "stops.csv"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCommand(t, transfersCmd, "127", "--stops-file", stops)
+	if code != exitError {
+		t.Errorf("exit status = %d, want %d", code, exitError)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want nothing", stdout)
+	}
+	if !strings.HasPrefix(stderr, "Error: loading transfers: ") || strings.Contains(stderr, "Usage:") {
+		t.Errorf("stderr = %q, want the error without the usage", stderr)
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, injected at build time with:
+//
+//	go build -ldflags "-X github.com/thosib/mta-cli/cmd.Version=v0.1.0 \
+//	  -X github.com/thosib/mta-cli/cmd.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/thosib/mta-cli/cmd.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "none"
+	BuildDate = "unknown"
+)
+
+// versionJSON prints the version as JSON instead of one field per line
+var versionJSON bool
+
+// versionText returns the build metadata, one field per line
+func versionText() string {
+	return fmt.Sprintf("version: %s\ncommit: %s\nbuilt: %s\n", Version, Commit, BuildDate)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and build metadata",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if versionJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(map[string]string{
+				"version": Version,
+				"commit":  Commit,
+				"built":   BuildDate,
+			})
+			return
+		}
+		fmt.Print(versionText())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVar(&versionJSON, "json", false, "Print the version as JSON")
+
+	// Also support mta-cli --version
+	rootCmd.Version = Version
+	rootCmd.SetVersionTemplate(versionText())
+}
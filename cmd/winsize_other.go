@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package cmd
+
+import "os"
+
+// terminalHeight returns 0 where the terminal size is not available
+func terminalHeight(f *os.File) int {
+	return 0
+}
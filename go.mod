@@ -2,11 +2,11 @@ module github.com/thosib/mta-cli
 
 go 1.25.5
 
-require github.com/spf13/cobra v1.10.2
-
 require (
-	github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs v1.0.0 // indirect
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.9 // indirect
-	google.golang.org/protobuf v1.36.11 // indirect
+	github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs v1.0.0
+	github.com/spf13/cobra v1.10.2
+	github.com/spf13/pflag v1.0.9
+	google.golang.org/protobuf v1.36.11
 )
+
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect